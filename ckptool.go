@@ -22,11 +22,18 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 	"github.com/mikejac/ssh.golang"
 	"github.com/docopt/docopt-go"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 /*
@@ -57,6 +64,7 @@ type HostData struct {
 	LogicalInterfaces		sshtool.LogicalInterfaces
 	PhysicalInterfaces	sshtool.PhysicalInterfaces
 	Routes					sshtool.Routes
+	RouteInfo				[]RouteInfo					// origin, cost and next hops of the routes from 'show route'
 	Cpha					*sshtool.CphaData
 	
 	//ConnectOk				bool
@@ -66,14 +74,20 @@ type HostData struct {
 	//InfoText				string
 	FwVer					string
 	Platform				string
+
+	ClishConfig			string						// 'show configuration', only collected by migrate
 	
 	Errors					uint
 }
 
 type ClusterData struct {
 	Name					string
+	Members				[]string
 	Hosts					map[string]HostData
 	Routes					map[string]sshtool.Routes
+	Mismatches				[]ClusterRoute
+	Ignored				[]IgnoredRoute
+	InterfaceMismatches	[]InterfaceMismatch
 	
 	Errors					uint
 }
@@ -87,184 +101,430 @@ const (
 	errPhysicalInterfaces	uint = 0x08
 	errRoutes					uint = 0x10
 	errCpha					uint = 0x20
+	errIPv6					uint = 0x40
 	
 	errRouteMismatch			uint = 0x01
 	errCphaStat				uint = 0x02
+	errInterfaceMismatch		uint = 0x04
+	errMembers					uint = 0x08
 )
 
 var (
 	verbose	int
 	flags		uint
 	hostsFile	string	= "hosts.ini"
+	verboseOut	io.Writer	= os.Stdout			// stderr when stdout carries a json document
 )
 
 func main() {
 	usage := `Ckp Tool.
 
 Usage:
-  ckptool [--verbose] cluster host1 <host1> host2 <host2> user <username>
-  ckptool [--verbose] cluster name <cluster-name> user <username>
-  ckptool [--verbose] migrate host <host> user <username>
-  ckptool [--verbose] xbm <host> user <username>
-  ckptool [--verbose] check user <username> [--summary]
-  ckptool [--verbose] all user <username>
+  ckptool [--verbose] cluster host1 <host1> host2 <host2> user <username> [--format=<fmt>] [--replay=<snap>]
+  ckptool [--verbose] cluster name <cluster-name> user <username> [--format=<fmt>] [--replay=<snap>]
+  ckptool [--verbose] migrate host <host> user <username> [--format=<fmt>] [--replay=<snap>] [--map=<file>]
+  ckptool [--verbose] migrate xbm <host> vap <group> user <username> --map=<file> [--format=<fmt>]
+  ckptool [--verbose] xbm <host> user <username> [--format=<fmt>]
+  ckptool [--verbose] check user <username> [--summary] [--parallel=<n>] [--format=<fmt>] [--replay=<snap>]
+  ckptool [--verbose] all user <username> [--parallel=<n>] [--replay=<snap>]
+  ckptool [--verbose] snapshot user <username> [--parallel=<n>] [--dir=<dir>]
+  ckptool [--verbose] diff <snapA> <snapB>
+  ckptool [--verbose] import <capture> [--dir=<dir>]
+  ckptool lint-clish <file>
+  ckptool [--verbose] exporter user <username> [--parallel=<n>] [--listen=<addr>] [--interval=<sec>]
+  ckptool plugin cluster <cluster-name> user <username>
+  ckptool plugin host <host> user <username>
+  ckptool vault init
+  ckptool vault (set|get|remove) <key>
+  ckptool vault list
   ckptool -h | --help
   ckptool --version
 
 Options:
-  -h --help     Show this screen.
-  --version     Show version.
-  --verbose     Verbose output.`
+  -h --help         Show this screen.
+  --version         Show version.
+  --verbose         Verbose output.
+  --parallel=<n>    Number of hosts to collect concurrently [default: 1].
+  --format=<fmt>    Output format, text or json; migrate also takes clish (same as text),
+                    gaia-api and ansible [default: text].
+  --dir=<dir>       Directory in which snapshots are stored [default: snapshots].
+  --listen=<addr>   Address the exporter listens on [default: :9642].
+  --interval=<sec>  Seconds between exporter collections [default: 300].
+  --replay=<snap>   Use the data of a snapshot directory or json file instead of the gateways.
+  --map=<file>      Rename the interfaces of the source gateway as given in the file;
+                    migrate xbm needs it to turn the circuits of a VAP into Gaia interfaces.
+
+Host keys:
+  The host keys of gateways and jump hosts are checked against known_hosts, ~/.ssh/known_hosts
+  unless hosts.ini sets another file, as host_key_checking in hosts.ini says:
+    yes         only hosts in known_hosts are logged in to
+    accept-new  unknown hosts are added to known_hosts, changed keys are refused [the default]
+    no          any host key is accepted`
 
 	arguments, _ := docopt.Parse(usage, nil, true, "Ckp Tool 1.0", false)
 	
 	if arguments["--verbose"].(bool) {
 		verbose = 1
-		fmt.Println(arguments)
-		fmt.Println()
 	}
 	
 	if arguments["--summary"].(bool) {
 		flags += flagSummary
 	}
 
-	hosts, err := NewHosts(hostsFile)	
+	parallel, err := strconv.Atoi(arguments["--parallel"].(string))
+	if err != nil || parallel < 1 {
+		fmt.Printf("ERROR: invalid --parallel value: %s\n", arguments["--parallel"].(string))
+		return
+	}
+
+	format := arguments["--format"].(string)
+
+	switch format {
+	case "text", "json":
+	case "clish", "gaia-api", "ansible":
+		if !arguments["migrate"].(bool) {
+			fmt.Printf("ERROR: --format=%s is only supported by migrate\n", format)
+			return
+		}
+	default:
+		fmt.Printf("ERROR: invalid --format value: %s\n", format)
+		return
+	}
+
+	// in json mode stdout carries nothing but the json document; progress goes to stderr
+	var text io.Writer = os.Stdout
+
+	if format == "json" || format == "gaia-api" || format == "ansible" {
+		text = os.Stderr
+	}
+
+	verboseOut = text
+
+	if verbose >= 1 {
+		fmt.Fprintln(verboseOut, arguments)
+		fmt.Fprintln(verboseOut)
+	}
+
+	hosts, err := NewHosts(hostsFile)
 	if err != nil {
-		fmt.Printf("WARNING: failed to load hostsfile (%s): %s\n", hostsFile, err.Error())		
+		fmt.Fprintf(os.Stderr, "WARNING: failed to load hostsfile (%s): %s\n", hostsFile, err.Error())
 	}
 			
+	credentials, err := NewCredentialStore(hosts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	replay, _ := arguments["--replay"].(string)
+
+	// the vault is only needed by the commands which log in to hosts
+	var vault *VaultData
+
+	if _, ok := arguments["<username>"].(string); ok && replay == "" {
+		if vault, err = LoadVault(hosts, credentials); err != nil {
+			if arguments["plugin"].(bool) {
+				os.Exit(PrintPlugin(os.Stdout, PluginResult{Status: pluginUnknown, Text: err.Error()}))
+			}
+
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
 	print := NewPrint(os.Stdout)
 	
-	if arguments["xbm"].(bool) {
-		host := hosts.GetHostIP(arguments["<host>"].(string))
-		
-		password, ok := Credentials("SSH Password: ")
-		if !ok {
-			return
+	if arguments["plugin"].(bool) {
+		// the plugin prints exactly one line and reports the result through its exit code
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		// a host without a password is not logged in to, which says nothing about the host itself
+		var names []string
+
+		if arguments["cluster"].(bool) {
+			names = hosts.GetClusterMembers(arguments["<cluster-name>"].(string))
+		} else {
+			names = []string{arguments["<host>"].(string)}
 		}
 
-		expert_password, ok := Credentials("Unix Password: ")
-		if !ok {
-			return
+		for _, name := range names {
+			if _, err := hosts.GetConnSettings(name, login); err != nil {
+				os.Exit(PrintPlugin(os.Stdout, PluginResult{Status: pluginUnknown, Text: err.Error()}))
+			}
+		}
+
+		var result PluginResult
+
+		if arguments["cluster"].(bool) {
+			clusterData, _ := checkCluster(ioutil.Discard, hosts, arguments["<cluster-name>"].(string), login, nil, flags, verbose)
+
+			result = PluginCluster(clusterData)
+		} else {
+			hostData, _ := checkStandalone(ioutil.Discard, hosts, arguments["<host>"].(string), login, verbose)
+
+			result = PluginHost(hostData)
 		}
+
+		os.Exit(PrintPlugin(os.Stdout, result))
+	} else if arguments["xbm"].(bool) && !arguments["migrate"].(bool) {
+		host := hosts.GetHostIP(arguments["<host>"].(string))
 		
-		fmt.Println("Host: " + host)
+		fmt.Fprintln(text, "Host: " + host)
 		
-		doXBM(host, arguments["<username>"].(string), password, expert_password, 22, verbose)
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		vaps, _ := doXBM(text, mustConnSettings(hosts, arguments["<host>"].(string), login), verbose)
+
+		if format == "json" {
+			doc := NewJsonDocument("xbm")
+
+			for _, vap := range vaps {
+				doc.Hosts = append(doc.Hosts, NewJsonHost(vap.HostData, host, vap.Ok))
+			}
+
+			print.PrintJSON(doc)
+		} else {
+			print.PrintVAPs(vaps)
+		}
 		
 	} else if arguments["cluster"].(bool) {
-		var host1 string
-		var host2 string
+		var names []string
+
+		clusterName, _ := arguments["<cluster-name>"].(string)
 				
 		if arguments["name"].(bool) {
-			members := hosts.GetClusterMembers(arguments["<cluster-name>"].(string))
+			names = hosts.GetClusterMembers(clusterName)
 
-			if len(members) == 2 {
-				host1 = hosts.GetHostIP(members[0])
-				host2 = hosts.GetHostIP(members[1])
-			} else {
-				fmt.Printf("ERROR: cluster does not contain exactly two members\n")		
+			if len(names) < 2 {
+				fmt.Fprintf(text, "ERROR: cluster does not contain at least two members\n")
+				return
 			}
 		} else {
-			host1 = hosts.GetHostIP(arguments["<host1>"].(string))
-			host2 = hosts.GetHostIP(arguments["<host2>"].(string))
+			names = []string{arguments["<host1>"].(string), arguments["<host2>"].(string)}
 		}
 
-		password, ok := Credentials("SSH Password: ")
-		if !ok {
-			return
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		hostData := make([]HostData, len(names))
+		hostOk   := make([]bool, len(names))
+		routes   := make(map[string]sshtool.Routes)
+		allOk    := true
+
+		for index, name := range names {
+			conn := mustConnSettings(hosts, name, login)
+
+			fmt.Fprintf(text, "Host %d: %s\n", index + 1, conn.Host)
+			hostData[index], hostOk[index] = doHost(text, conn, verbose)
+			hostData[index].Name = name
+
+			if format == "text" {
+				print.PrintCPHA(hostData[index].Cpha)
+				fmt.Println()
+			}
+
+			allOk = allOk && hostOk[index]
 		}
 
-		expert_password, ok := Credentials("Expert Password: ")
-		if !ok {
-			return
+		ipv6Ok := true
+
+		for _, h := range hostData {
+			ipv6Ok = ipv6Ok && (h.Errors & errIPv6) == 0
 		}
 
-		fmt.Println("Host 1: " + host1)
-		hostData1, ok1 := doHost(host1, arguments["<username>"].(string), password, expert_password, 22, verbose)
-		
-		print.PrintCPHA(hostData1.Cpha)
-		fmt.Println()
-		
-		fmt.Println("Host 2: " + host2)
-		hostData2, ok2 := doHost(host2, arguments["<username>"].(string), password, expert_password, 22, verbose)
+		if !ipv6Ok {
+			fmt.Fprintf(text, "WARNING: IPv6 is left out of the comparison as it could not be retrieved from every host\n\n")
+		}
 
-		print.PrintCPHA(hostData2.Cpha)
-		fmt.Println()
+		for index, name := range names {
+			if !ipv6Ok {
+				hostData[index] = withoutIPv6(hostData[index])
+			}
+
+			routes[name] = hostData[index].Routes
+		}
 		
-		if ok1 && ok2 {
-			sharedRoutes, host1OnlyRoutes, host2OnlyRoutes := CompareNetworks(hostData1.Routes, hostData2.Routes, verbose)
+		var sharedRoutes	sshtool.Routes
+		var partialRoutes	[]ClusterRoute
+
+		ignoredRoutes := hosts.GetClusterIgnoredRoutes(clusterName)
+
+		if allOk {
+			sharedRoutes, partialRoutes = CompareClusterRoutes(names, routes, verbose)
+
+			if format == "text" {
+				hostMap := make(map[string]HostData)
+
+				for _, h := range hostData {
+					hostMap[h.Name] = h
+				}
+
+				print.PrintInterfaceMismatches(CompareClusterInterfaces(names, hostMap, verbose))
+
+				if len(names) == 2 {
+					shared, host1OnlyRoutes, host2OnlyRoutes := CompareNetworks(hostData[0].Routes, hostData[1].Routes, verbose)
 			
-			print.PrintComparedRoutes(sharedRoutes, host1OnlyRoutes, host2OnlyRoutes, hosts.GetClusterIgnoredRoutes(arguments["<cluster-name>"].(string)))
+					print.PrintComparedRoutes(names[0], names[1], shared, ClassifyRoutes(host1OnlyRoutes, hostData[1].Routes), ClassifyRoutes(host2OnlyRoutes, hostData[0].Routes), ignoredRoutes)
+				} else {
+					print.PrintClusterRoutes(sharedRoutes, partialRoutes, ignoredRoutes)
+				}
+			}
+		}
+
+		if format == "json" {
+			doc := NewJsonDocument("cluster")
+			doc.Clusters = append(doc.Clusters, NewJsonComparedCluster(clusterName, hostData, hostOk, sharedRoutes, partialRoutes, ignoredRoutes))
+
+			print.PrintJSON(doc)
 		}
 	} else if arguments["migrate"].(bool) {
 		host := hosts.GetHostIP(arguments["<host>"].(string))
 		
-		password, ok := Credentials("SSH Password: ")
-		if !ok {
-			return
+		fmt.Fprintln(text, "Host: " + host)
+		
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		var imap *InterfaceMap
+
+		if file, ok := arguments["--map"].(string); ok {
+			if imap, err = LoadInterfaceMap(file); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+				os.Exit(1)
+			}
 		}
 
-		expert_password, ok := Credentials("Expert Password: ")
-		if !ok {
-			return
+		conn := mustConnSettings(hosts, arguments["<host>"].(string), login)
+		source := arguments["<host>"].(string)
+
+		var hostData	HostData
+		var ok			bool
+
+		if arguments["xbm"].(bool) {
+			source += ", VAP group: " + arguments["<group>"].(string)
+
+			hostData, ok = doVAPGroup(text, conn, arguments["<group>"].(string), verbose)
+		} else {
+			hostData, ok = doHost(text, conn, verbose)
+			hostData.Name = arguments["<host>"].(string)
+
+			if ok {
+				fmt.Fprintf(text, "Retrieving routing table ... ")
+
+				// without it migrate falls back to taking every route as static
+				if hostData.RouteInfo, err = fetchRouteInfo(conn); err == nil {
+					fmt.Fprintf(text, "done\n")
+				} else {
+					fmt.Fprintln(text, "error: " + err.Error())
+				}
+
+				fmt.Fprintf(text, "Retrieving configuration ... ")
+
+				if hostData.ClishConfig, err = fetchConfiguration(conn); err == nil {
+					fmt.Fprintf(text, "done\n\n")
+				} else {
+					// the interfaces and routes can still be migrated
+					fmt.Fprintln(text, "error: " + err.Error())
+				}
+			}
 		}
-		
-		fmt.Println("Host: " + host)
-		
-		if hostData, ok := doHost(host, arguments["<username>"].(string), password, expert_password, 22, verbose); ok {
-			fmt.Println("# host: " + arguments["<host>"].(string))
+
+		if ok {
+			if imap != nil {
+				if hostData, err = imap.Apply(hostData); err != nil {
+					fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+					os.Exit(1)
+				}
+
+				for _, m := range imap.Unused() {
+					fmt.Fprintf(os.Stderr, "WARNING: unused interface mapping %s\n", m)
+				}
+			}
+		}
+
+		if format == "json" {
+			doc := NewJsonDocument("migrate")
+			doc.Hosts = append(doc.Hosts, NewJsonHost(hostData, host, ok))
+
+			print.PrintJSON(doc)
+		} else if ok && (format == "gaia-api" || format == "ansible") {
+			// the API has no calls for some of what the clish output migrates
+			for _, group := range GaiaLeftOut(hostData) {
+				fmt.Fprintf(os.Stderr, "WARNING: %s output leaves out %d command(s) of group '%s', e.g. '%s'\n", format, len(group.Commands), group.Name, group.Commands[0])
+			}
+
+			if format == "gaia-api" {
+				print.PrintGaiaAPI(hostData.Name, GaiaOperations(hostData))
+			} else {
+				print.PrintAnsible(hostData.Name, GaiaOperations(hostData))
+			}
+		} else if ok {
+			var script bytes.Buffer
+
+			scriptPrint := NewPrint(&script)
+
+			fmt.Fprintln(&script, "# host: " + source)
 			
 			// now print the data
-			print.PrintCPHA(hostData.Cpha)
-			print.PrintInterfaces(hostData.PhysicalInterfaces, hostData.LogicalInterfaces)
-			print.PrintRoutes(hostData.Routes)
+			scriptPrint.PrintCPHA(hostData.Cpha)
+
+			for _, group := range MigrationConfig(hostData, ParseClishConfig(hostData.ClishConfig)) {
+				scriptPrint.PrintConfigGroup(group)
+			}
+
+			// the problems go first so they are seen before the script is pasted into the new gateway
+			for _, problem := range LintClish(script.String()) {
+				fmt.Fprintf(os.Stderr, "WARNING: script %s\n", problem.String())
+			}
+
+			os.Stdout.Write(script.Bytes())
 		}
 	} else if arguments["check"].(bool) {
 		allStandalone := hosts.GetAllStandalone()
 		allCluster    := hosts.GetAllCluster()
 		
-		password, ok := Credentials("SSH Password: ")
-		if !ok {
-			return
-		}
-
-		expert_password, ok := Credentials("Expert Password: ")
-		if !ok {
-			return
-		}
-
 		/******************************************************************************************************************
 		 * extract data from all hosts and clusters
 		 *
 		 */
 		
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		standaloneData, standaloneOk, clusterAll, clusterOk := checkAll(text, hosts, allStandalone, allCluster, hosts.GetAllXBM(), login, parallel, flags, verbose)
+
 		var hostData []HostData
 		hostData = make([]HostData, 0)
-		
-		for _, h := range allStandalone {
-			hd, ok := checkStandalone(hosts, h, arguments["<username>"].(string), password, expert_password, 22, verbose)
-			if !ok {
+
+		for index, hd := range standaloneData {
+			if !standaloneOk[index] {
 				hostData = append(hostData, hd)
 			}
 		}
-		
+
 		var clusterData []ClusterData
 		clusterData = make([]ClusterData, 0)
-		
-		for _, c := range allCluster {
-			cd, ok := checkCluster(hosts, c, arguments["<username>"].(string), password, expert_password, 22, flags, verbose)
-			if !ok {
+
+		for index, cd := range clusterAll {
+			if !clusterOk[index] {
 				clusterData = append(clusterData, cd)
 			}
 		}
-		
+
 		/******************************************************************************************************************
 		 * print summary
 		 *
 		 */
 
-		if (flags & flagSummary) != 0 {
+		if format == "json" {
+			doc := NewJsonDocument("check")
+
+			for index, hd := range standaloneData {
+				doc.Hosts = append(doc.Hosts, NewJsonHost(hd, hosts.GetHostIP(hd.Name), standaloneOk[index]))
+			}
+			for index, cd := range clusterAll {
+				doc.Clusters = append(doc.Clusters, NewJsonCluster(cd, clusterOk[index]))
+			}
+
+			print.PrintJSON(doc)
+		} else if (flags & flagSummary) != 0 {
 			fmt.Println()
 			fmt.Printf("=========================================================\n")
 			fmt.Printf("Summary\n")
@@ -295,6 +555,9 @@ Options:
 					if (h.Errors & errCpha) != 0 {
 						fmt.Printf("   Error: could not retrieve CPHA information\n")
 					}
+					if (h.Errors & errIPv6) != 0 {
+						fmt.Printf("   Error: could not retrieve IPv6 information\n")
+					}
 				}
 
 				fmt.Println()
@@ -307,13 +570,46 @@ Options:
 
 				if (c.Errors & errRouteMismatch) != 0 {
 					fmt.Printf("  Error: routes do not match on cluster members\n")
+
+					for _, match := range RouteMismatchOrder {
+						count := 0
+
+						for _, cr := range c.Mismatches {
+							if cr.Match() == match {
+								count++
+							}
+						}
+
+						if count > 0 {
+							fmt.Printf("   %-32s: %d\n", match.Description(), count)
+						}
+					}
+				}
+				if (c.Errors & errMembers) != 0 {
+					fmt.Printf("  Error: members not found\n")
 				}
 				if (c.Errors & errCphaStat) != 0 {
 					fmt.Printf("  Error: CPHA not working\n")
 				}
+				if (c.Errors & errInterfaceMismatch) != 0 {
+					fmt.Printf("  Error: interfaces do not match on cluster members\n")
+
+					for _, im := range c.InterfaceMismatches {
+						fmt.Printf("   %s\n", im.Description())
+					}
+				}
+				if len(c.Ignored) > 0 {
+					fmt.Printf("  Ignored routes:\n")
+
+					for _, ir := range c.Ignored {
+						fmt.Printf("   %-20s -> %-16s dev %-10s (rule: %s)\n", ir.Route.Net, ir.Route.Gateway, ir.Route.Dev, ir.Rule)
+					}
+				}
 				fmt.Println()
 				
-				for _/*name*/, h := range c.Hosts {
+				for _, name := range c.Members {
+					h := c.Hosts[name]
+
 					fmt.Printf("  Host: %s\n", h.Name /*name*/)
 					
 					if (h.Errors & errConnect) != 0 {
@@ -334,11 +630,32 @@ Options:
 						if (h.Errors & errCpha) != 0 {
 							fmt.Printf("   Error: could not retrieve CPHA information\n")
 						}
+						if (h.Errors & errIPv6) != 0 {
+							fmt.Printf("   Error: could not retrieve IPv6 information\n")
+						}
 						if len(c.Routes[h.Name]) > 0 {
 							fmt.Printf("   Mismatched routes:\n")
-							
-							for _, r := range c.Routes[h.Name] {
-								fmt.Printf("    %-20s -> %-16s dev %s\n", r.Net, r.Gateway, r.Dev)
+
+							for _, match := range RouteMismatchOrder {
+								header := false
+
+								for _, cr := range c.Mismatches {
+									if cr.Match() != match || !memberOf(h.Name, cr.Present) {
+										continue
+									}
+
+									if !header {
+										fmt.Printf("    %s:\n", match.Description())
+										header = true
+									}
+
+									fmt.Printf("     %-20s -> %-16s dev %s\n", cr.Route.Net, cr.Route.Gateway, cr.Route.Dev)
+
+									// with more than two members it is not obvious where the route is missing
+									if len(c.Members) > 2 {
+										fmt.Printf("      missing on: %s\n", strings.Join(cr.Missing, ", "))
+									}
+								}
 							}
 							
 							fmt.Println()
@@ -352,152 +669,490 @@ Options:
 	} else if arguments["all"].(bool) {
 		allHosts := hosts.GetAllHosts()
 		
-		password, ok := Credentials("SSH Password: ")
-		if !ok {
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		runParallel(os.Stdout, len(allHosts), parallel, func(index int, out io.Writer) {
+			fmt.Fprintln(out, "Host: " + allHosts[index])
+
+			if conn, err := hosts.GetConnSettings(allHosts[index], login); err == nil {
+				doHost(out, conn, verbose)
+			} else {
+				fmt.Fprintln(out, "error: " + err.Error())
+			}
+
+			fmt.Fprintln(out, "========================================================")
+		})
+	} else if arguments["snapshot"].(bool) {
+		allHosts := hosts.GetAllHosts()
+		
+		snapDir, err := NewSnapshotDir(arguments["--dir"].(string))
+		if err != nil {
+			fmt.Printf("ERROR: failed to create snapshot directory: %s\n", err.Error())
 			return
 		}
 
-		expert_password, ok := Credentials("Expert Password: ")
-		if !ok {
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		runParallel(os.Stdout, len(allHosts), parallel, func(index int, out io.Writer) {
+			hd, ok := checkStandalone(out, hosts, allHosts[index], login, verbose)
+
+			// only migrate needs the routing table, a snapshot keeps it for migrating from the snapshot
+			if (hd.Errors & errConnect) == 0 {
+				conn, _ := hosts.GetConnSettings(hd.Name, login)
+
+				if info, err := fetchRouteInfo(conn); err == nil {
+					hd.RouteInfo = info
+					fmt.Fprintf(out, "host:%s:route_info:true\n", hd.Name)
+				} else {
+					fmt.Fprintf(out, "host:%s:route_info:false\n", hd.Name)
+				}
+			}
+
+			if err := SaveSnapshotHost(snapDir, NewJsonHost(hd, hosts.GetHostIP(hd.Name), ok)); err != nil {
+				fmt.Fprintf(out, "host:%s:snapshot:false\n", hd.Name)
+				fmt.Fprintln(out, "error: " + err.Error())
+			} else {
+				fmt.Fprintf(out, "host:%s:snapshot:true\n", hd.Name)
+			}
+		})
+
+		fmt.Println()
+		fmt.Println("Snapshot: " + snapDir)
+	} else if arguments["exporter"].(bool) {
+		interval, err := strconv.Atoi(arguments["--interval"].(string))
+		if err != nil || interval < 1 {
+			fmt.Printf("ERROR: invalid --interval value: %s\n", arguments["--interval"].(string))
 			return
 		}
-		
-		for _, h := range allHosts {
-			fmt.Println("Host: " + h)
-			
-			doHost(hosts.GetHostIP(h), arguments["<username>"].(string), password, expert_password, 22, verbose)
-			fmt.Println("========================================================")
+
+		login := Login{User: arguments["<username>"].(string), Port: 22, Credentials: credentials, Vault: vault, Replay: replay}
+
+		exporter := NewExporter(func() ([]HostData, []ClusterData, []bool) {
+			hostData, _, clusterData, clusterOk := checkAll(ioutil.Discard, hosts, hosts.GetAllStandalone(), hosts.GetAllCluster(), hosts.GetAllXBM(), login, parallel, flags, verbose)
+
+			return hostData, clusterData, clusterOk
+		})
+
+		fmt.Printf("Serving metrics on %s/metrics\n", arguments["--listen"].(string))
+
+		if err := exporter.Run(arguments["--listen"].(string), time.Duration(interval) * time.Second); err != nil {
+			fmt.Println("error: " + err.Error())
+		}
+	} else if arguments["diff"].(bool) {
+		hostsA, err := LoadSnapshot(arguments["<snapA>"].(string))
+		if err != nil {
+			fmt.Println("error: " + err.Error())
+			return
+		}
+
+		hostsB, err := LoadSnapshot(arguments["<snapB>"].(string))
+		if err != nil {
+			fmt.Println("error: " + err.Error())
+			return
+		}
+
+		print.PrintSnapshotDiff(DiffSnapshots(hostsA, hostsB, verbose))
+	} else if arguments["import"].(bool) {
+		dirs, err := ImportDirs(arguments["<capture>"].(string))
+		if err != nil {
+			fmt.Println("error: " + err.Error())
+			return
+		}
+
+		snapDir, err := NewSnapshotDir(arguments["--dir"].(string))
+		if err != nil {
+			fmt.Printf("ERROR: failed to create snapshot directory: %s\n", err.Error())
+			return
+		}
+
+		for _, name := range sortedDirs(dirs) {
+			hd, ok, err := ImportHost(dirs[name], name)
+			if err == nil {
+				err = SaveSnapshotHost(snapDir, NewJsonHost(hd, hosts.GetHostIP(name), ok))
+			}
+
+			if err != nil {
+				fmt.Printf("host:%s:import:false\n", name)
+				fmt.Println("error: " + err.Error())
+			} else {
+				fmt.Printf("host:%s:import:true\n", name)
+				fmt.Printf("host:%s:ok:%t\n", name, ok)
+			}
+		}
+
+		fmt.Println()
+		fmt.Println("Snapshot: " + snapDir)
+	} else if arguments["lint-clish"].(bool) {
+		file := arguments["<file>"].(string)
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Println("error: " + err.Error())
+			os.Exit(1)
+		}
+
+		problems := LintClish(string(b))
+
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", file, problem.String())
+		}
+
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+
+		fmt.Println(file + ": ok")
+	} else if arguments["vault"].(bool) {
+		file := VaultFile(hosts)
+
+		if arguments["init"].(bool) {
+			passphrase, ok := credentials.Get(credVault, "Vault Passphrase: ")
+			if !ok {
+				os.Exit(1)
+			}
+
+			// a mistyped passphrase would make the vault useless so it is asked for twice
+			if _, set := os.LookupEnv("CKPTOOL_VAULT_PASSWORD"); !set && terminal.IsTerminal(int(syscall.Stdin)) {
+				if again, _ := Credentials("Repeat Vault Passphrase: "); again != passphrase {
+					fmt.Fprintf(os.Stderr, "ERROR: passphrases do not match\n")
+					os.Exit(1)
+				}
+			}
+
+			if _, err := CreateVault(file, passphrase); err != nil {
+				fmt.Println("error: " + err.Error())
+				os.Exit(1)
+			}
+
+			fmt.Println("Vault: " + expandHome(file))
+			return
+		}
+
+		passphrase, ok := credentials.Get(credVault, "Vault Passphrase: ")
+		if !ok {
+			os.Exit(1)
+		}
+
+		vault, err := OpenVault(file, passphrase)
+		if err != nil {
+			fmt.Println("error: " + err.Error())
+			os.Exit(1)
+		}
+
+		key, _ := arguments["<key>"].(string)
+		entry, found := vault.Entries[key]
+
+		if arguments["set"].(bool) {
+			if !terminal.IsTerminal(int(syscall.Stdin)) {
+				fmt.Fprintf(os.Stderr, "ERROR: vault set needs a terminal\n")
+				os.Exit(1)
+			}
+
+			// an empty answer keeps the current value
+			if password, _ := Credentials("SSH Password for " + key + ": "); password != "" {
+				entry.SSHPassword = password
+			}
+			if password, _ := Credentials("Expert Password for " + key + ": "); password != "" {
+				entry.ExpertPassword = password
+			}
+
+			vault.Entries[key] = entry
+
+			if err := vault.Save(); err != nil {
+				fmt.Println("error: " + err.Error())
+				os.Exit(1)
+			}
+		} else if arguments["get"].(bool) {
+			if !found {
+				fmt.Fprintf(os.Stderr, "ERROR: no vault entry for %s\n", key)
+				os.Exit(1)
+			}
+
+			fmt.Printf("ssh_password    = %s\n", entry.SSHPassword)
+			fmt.Printf("expert_password = %s\n", entry.ExpertPassword)
+		} else if arguments["remove"].(bool) {
+			if !found {
+				fmt.Fprintf(os.Stderr, "ERROR: no vault entry for %s\n", key)
+				os.Exit(1)
+			}
+
+			delete(vault.Entries, key)
+
+			if err := vault.Save(); err != nil {
+				fmt.Println("error: " + err.Error())
+				os.Exit(1)
+			}
+		} else if arguments["list"].(bool) {
+			for _, k := range vault.Keys() {
+				var kinds []string
+
+				if vault.Entries[k].SSHPassword != "" {
+					kinds = append(kinds, credSSH)
+				}
+				if vault.Entries[k].ExpertPassword != "" {
+					kinds = append(kinds, credExpert)
+				}
+
+				fmt.Printf("%-32s %s\n", k, strings.Join(kinds, ","))
+			}
 		}
 	}
 }
 
 //
+// mustConnSettings returns the connection settings of the host a command works on, or stops when a
+// password of the host can't be found; logging in with an empty one gets nowhere
 //
-func doHost(host string, user string, passw string, su_passw string, port int, verbose int) (hostData HostData, ok bool) {
-	ssh, err := sshtool.NewSshAction(host, user, passw, su_passw, port, verbose)
+func mustConnSettings(hosts *HostsData, name string, login Login) (conn ConnSettings) {
+	conn, err := hosts.GetConnSettings(name, login)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	return conn
+}
+
+//
+//
+func doHost(out io.Writer, conn ConnSettings, verbose int) (hostData HostData, ok bool) {
+	ssh, err := newGateway(conn, verbose)
 
 	if err == nil {
-		var logical	sshtool.LogicalInterfaces
-		var physical	sshtool.PhysicalInterfaces
-		var routes		sshtool.Routes
-		var cpha		*sshtool.CphaData
-		
-		fmt.Printf("Connecting ... ")
+		fmt.Fprintf(out, "Connecting ... ")
 		
 		if err := ssh.Connect(); err == nil {
-			fmt.Printf("done\n")
-			fmt.Printf("Retriveing OS information ... ")
+			fmt.Fprintf(out, "done\n")
+			fmt.Fprintf(out, "Retriveing OS information ... ")
 
-			if _, _, err := ssh.GetOS(); err == nil {
-				fmt.Printf("done\n")
-				fmt.Printf("Retrieving logical interface information ... ")
+			if hostData.Osclass, hostData.Ostype, err = ssh.GetOS(); err == nil {
+				fmt.Fprintf(out, "done\n")
 
-				if logical, err = ssh.GetInterfaces(); err == nil {
-					fmt.Printf("done\n")
-					fmt.Printf("Retrieving physical interface information ... ")
-
-					if physical, err = ssh.GetPhyInterfaces(logical); err == nil {
-						fmt.Printf("done\n")
-						fmt.Printf("Retrieving routes ... ")
-
-						if routes, err = ssh.GetRoutes(); err == nil {
-							fmt.Printf("done\n")
-							fmt.Printf("Retrieving HA information ... ")
-
-							if cpha, err = ssh.GetCPHA(); err == nil {
-								fmt.Printf("done\n\n")
-
-								hostData.LogicalInterfaces	= logical
-								hostData.PhysicalInterfaces	= physical
-								hostData.Routes				= routes
-								hostData.Cpha					= cpha
-								
-								return hostData, true
-							} else {
-								fmt.Println("error: " + err.Error())		
-							}
-						} else {
-							fmt.Println("error: " + err.Error())		
-						}
+				if hostData, ok = collectHost(out, ssh, hostData); ok {
+					fmt.Fprintf(out, "Retrieving IPv6 information ... ")
+
+					if logical6, routes6, err := ssh.GetIPv6(); err == nil {
+						fmt.Fprintf(out, "done\n")
+
+						hostData.LogicalInterfaces	= append(hostData.LogicalInterfaces, logical6...)
+						hostData.Routes			= append(hostData.Routes, routes6...)
 					} else {
-						fmt.Println("error: " + err.Error())		
+						hostData.Errors |= errIPv6
+						fmt.Fprintln(out, "error: " + err.Error())
 					}
-				} else {
-					fmt.Println("error: " + err.Error())		
+
+					fmt.Fprintf(out, "\n")
+
+					return hostData, true
 				}
 			} else {
-				fmt.Println("error: " + err.Error())		
+				hostData.Errors |= errOS
+				fmt.Fprintln(out, "error: " + err.Error())
 			}
 			
 			ssh.Exit()
 			ssh.Disconnect()
+		} else {
+			hostData.ConnectText = err.Error()
+			hostData.Errors |= errConnect
+			fmt.Fprintln(out, "error: " + err.Error())
 		}
 	} else {
-		fmt.Println("error: " + err.Error())		
+		hostData.ConnectText = err.Error()
+		hostData.Errors |= errConnect
+		fmt.Fprintln(out, "error: " + err.Error())
 	}
 	
 	return hostData, false
 }
 
 //
+// collectHost retrieves the interfaces, routes and HA state of a gateway, or of the VAP the gateway is
+// connected to, and stops at the first failure
+//
+func collectHost(out io.Writer, ssh Gateway, hostData HostData) (collected HostData, ok bool) {
+	var logical	sshtool.LogicalInterfaces
+	var physical	sshtool.PhysicalInterfaces
+	var routes		sshtool.Routes
+	var cpha		*sshtool.CphaData
+	var err		error
+
+	fmt.Fprintf(out, "Retrieving logical interface information ... ")
+
+	if logical, err = ssh.GetInterfaces(); err == nil {
+		fmt.Fprintf(out, "done\n")
+		fmt.Fprintf(out, "Retrieving physical interface information ... ")
+
+		if physical, err = ssh.GetPhyInterfaces(logical); err == nil {
+			fmt.Fprintf(out, "done\n")
+			fmt.Fprintf(out, "Retrieving routes ... ")
+
+			if routes, err = ssh.GetRoutes(); err == nil {
+				fmt.Fprintf(out, "done\n")
+				fmt.Fprintf(out, "Retrieving HA information ... ")
+
+				if cpha, err = ssh.GetCPHA(); err == nil {
+					fmt.Fprintf(out, "done\n")
+
+					hostData.LogicalInterfaces	= logical
+					hostData.PhysicalInterfaces	= physical
+					hostData.Routes				= routes
+					hostData.Cpha					= cpha
+					
+					return hostData, true
+				} else {
+					hostData.Errors |= errCpha
+					fmt.Fprintln(out, "error: " + err.Error())
+				}
+			} else {
+				hostData.Errors |= errRoutes
+				fmt.Fprintln(out, "error: " + err.Error())
+			}
+		} else {
+			hostData.Errors |= errPhysicalInterfaces
+			fmt.Fprintln(out, "error: " + err.Error())
+		}
+	} else {
+		hostData.Errors |= errLogicalInterfaces
+		fmt.Fprintln(out, "error: " + err.Error())
+	}
+
+	return hostData, false
+}
+
+//
+// doXBM walks every VAP of every VAP group on a CrossBeam CPM and collects each VAP like doHost() collects
+// a gateway. A VAP which fails is reported and skipped
 //
-func doXBM(host string, user string, passw string, su_passw string, port int, verbose int) (ok bool) {
-	ssh, err := sshtool.NewSshAction(host, user, passw, su_passw, port, verbose)
+func doXBM(out io.Writer, conn ConnSettings, verbose int) (vaps []VAPData, ok bool) {
+	ssh, err := newGateway(conn, verbose)
 
 	var osclass		sshtool.OsClass
 
 	if err == nil {
-		fmt.Printf("Connecting ... ")
+		fmt.Fprintf(out, "Connecting ... ")
 		
 		if err := ssh.Connect(); err == nil {
-			fmt.Printf("done\n")
-			fmt.Printf("Retriveing OS information ... ")
+			fmt.Fprintf(out, "done\n")
+			fmt.Fprintf(out, "Retriveing OS information ... ")
 
 			if osclass, _, err = ssh.GetOS(); err == nil {
-				fmt.Printf("done\n")
+				fmt.Fprintf(out, "done\n")
 				
 				if osclass == sshtool.OsClassXBM {
+					fmt.Fprintf(out, "Retrieving VAP groups ... ")
+
 					if vapGroups, err := ssh.GetVAPGroups(); err == nil {
-						fmt.Printf("vapGroups = %v\n", vapGroups)	
-						
-						if err = ssh.ConnectVAP("X02_RTVLPA_DK", 1); err == nil {
-							
-							ssh.DisconnectVAP()
-						} else {
-							fmt.Println("error: " + err.Error())								
+						fmt.Fprintf(out, "done\n")
+
+						ok = true
+
+						for _, group := range sortedVAPGroups(vapGroups) {
+							for index := 1; index <= vapGroups[group]; index++ {
+								vap := VAPData{Group: group, Index: index}
+								vap.HostData.Name = vap.Name()
+
+								fmt.Fprintf(out, "\nVAP: %s\n", vap.Name())
+								fmt.Fprintf(out, "Connecting to VAP ... ")
+
+								if err = ssh.ConnectVAP(group, index); err == nil {
+									fmt.Fprintf(out, "done\n")
+
+									vap.HostData, vap.Ok = collectHost(out, ssh, vap.HostData)
+
+									ssh.DisconnectVAP()
+								} else {
+									vap.HostData.ConnectText = err.Error()
+									vap.HostData.Errors |= errConnect
+									fmt.Fprintln(out, "error: " + err.Error())
+								}
+
+								ok = ok && vap.Ok
+								vaps = append(vaps, vap)
+							}
 						}
+
+						fmt.Fprintln(out)
 					} else {
-						fmt.Println("error: " + err.Error())								
+						fmt.Fprintln(out, "error: " + err.Error())
 					}
 
 				} else {
-					fmt.Println("error: host is not an CrossBeam CPM")							
+					fmt.Fprintln(out, "error: host is not an CrossBeam CPM")
 				}
 
 			} else {
-				fmt.Println("error: " + err.Error())		
+				fmt.Fprintln(out, "error: " + err.Error())
 			}
 			
 			ssh.Exit()
 			ssh.Disconnect()
+		} else {
+			fmt.Fprintln(out, "error: " + err.Error())
 		}
 	} else {
-		fmt.Println("error: " + err.Error())		
+		fmt.Fprintln(out, "error: " + err.Error())
 	}
 	
-	return false
+	return vaps, ok
 }
 
 //
+// checkAll runs checkStandalone(), checkCluster() and checkXBM() on the given hosts, clusters and chassis
+// with at most 'parallel' hosts, cluster members included, being collected at the same time. The VAP
+// groups of the chassis are returned after the clusters
 //
-func checkStandalone(hosts *HostsData, hostname string, user string, passw string, su_passw string, port int, verbose int) (hostData HostData, ok bool) {
+func checkAll(out io.Writer, hosts *HostsData, allStandalone []string, allCluster []string, allXBM []string, login Login, parallel int, flags uint, verbose int) (standaloneData []HostData, standaloneOk []bool, clusterData []ClusterData, clusterOk []bool) {
+	standaloneData	= make([]HostData, len(allStandalone))
+	standaloneOk	= make([]bool, len(allStandalone))
+
+	// the members of the clusters are collected in parallel, the slots keep them within 'parallel'
+	slots := newHostSlots(parallel)
+
+	runParallel(out, len(allStandalone), parallel, func(index int, out io.Writer) {
+		slots.collect(func() {
+			standaloneData[index], standaloneOk[index] = checkStandalone(out, hosts, allStandalone[index], login, verbose)
+		})
+	})
+
+	clusterData	= make([]ClusterData, len(allCluster))
+	clusterOk		= make([]bool, len(allCluster))
+
+	runParallel(out, len(allCluster), parallel, func(index int, out io.Writer) {
+		clusterData[index], clusterOk[index] = checkCluster(out, hosts, allCluster[index], login, slots, flags, verbose)
+	})
+
+	xbmData	:= make([][]ClusterData, len(allXBM))
+	xbmOk		:= make([][]bool, len(allXBM))
+
+	runParallel(out, len(allXBM), parallel, func(index int, out io.Writer) {
+		slots.collect(func() {
+			xbmData[index], xbmOk[index] = checkXBM(out, hosts, allXBM[index], login, verbose)
+		})
+	})
+
+	for index := range allXBM {
+		clusterData	= append(clusterData, xbmData[index]...)
+		clusterOk		= append(clusterOk, xbmOk[index]...)
+	}
+
+	return standaloneData, standaloneOk, clusterData, clusterOk
+}
+
+//
+//
+func checkStandalone(out io.Writer, hosts *HostsData, hostname string, login Login, verbose int) (hostData HostData, ok bool) {
 	hostData.Name = hostname
 	
-	h := hosts.GetHostIP(hostname)
+	conn, err := hosts.GetConnSettings(hostname, login)
 
-	fmt.Printf("host:%s:addr:%s\n", hostname, h)
+	fmt.Fprintf(out, "host:%s:addr:%s\n", hostname, conn.Host)
 	
-	ssh, err := sshtool.NewSshAction(h, user, passw, su_passw, port, verbose)
+	var ssh Gateway
+
+	if err == nil {
+		ssh, err = newGateway(conn, verbose)
+	}
 
 	if err == nil {
 		if err := ssh.Connect(); err == nil {
@@ -513,60 +1168,70 @@ func checkStandalone(hosts *HostsData, hostname string, user string, passw strin
 					hostData.FwVer	= fwver
 					hostData.Platform	= platform
 					
-					fmt.Printf("host:%s:fwver:\"%s\"\n", hostname, fwver)
-					fmt.Printf("host:%s:platform:\"%s\"\n", hostname, platform)
+					fmt.Fprintf(out, "host:%s:fwver:\"%s\"\n", hostname, fwver)
+					fmt.Fprintf(out, "host:%s:platform:\"%s\"\n", hostname, platform)
 				} else {
 					hostData.Errors |= errOS
 
-					fmt.Printf("host:%s:fwver:null\n", hostname)
-					fmt.Printf("host:%s:platform:null\n", hostname)
+					fmt.Fprintf(out, "host:%s:fwver:null\n", hostname)
+					fmt.Fprintf(out, "host:%s:platform:null\n", hostname)
 				}
 				
 				if logical, err = ssh.GetInterfaces(); err == nil {
 					if len(logical) == 0 {
 						hostData.Errors |= errLogicalInterfaces
-						fmt.Printf("host:%s:logical:false\n", hostname)
+						fmt.Fprintf(out, "host:%s:logical:false\n", hostname)
 					} else {
 						hostData.LogicalInterfaces = logical
-						fmt.Printf("host:%s:logical:true\n", hostname)
+						fmt.Fprintf(out, "host:%s:logical:true\n", hostname)
 					}
 				} else {
 					hostData.Errors |= errLogicalInterfaces
-					fmt.Printf("host:%s:logical:false\n", hostname)
+					fmt.Fprintf(out, "host:%s:logical:false\n", hostname)
 				}
 				
 				if physical, err = ssh.GetPhyInterfaces(logical); err == nil {
 					if len(physical) == 0 {
 						hostData.Errors |= errPhysicalInterfaces
-						fmt.Printf("host:%s:physical:false\n", hostname)
+						fmt.Fprintf(out, "host:%s:physical:false\n", hostname)
 					} else {
 						hostData.PhysicalInterfaces = physical
-						fmt.Printf("host:%s:physical:true\n", hostname)
+						fmt.Fprintf(out, "host:%s:physical:true\n", hostname)
 					}
 				} else {
 					hostData.Errors |= errPhysicalInterfaces
-					fmt.Printf("host:%s:physical:false\n", hostname)
+					fmt.Fprintf(out, "host:%s:physical:false\n", hostname)
 				}
 				
 				if routes, err = ssh.GetRoutes(); err == nil {
 					if len(routes) == 0 {
 						hostData.Errors |= errRoutes
-						fmt.Printf("host:%s:routes:false\n", hostname)
+						fmt.Fprintf(out, "host:%s:routes:false\n", hostname)
 					} else {
 						hostData.Routes = routes
-						fmt.Printf("host:%s:routes:true\n", hostname)
+						fmt.Fprintf(out, "host:%s:routes:true\n", hostname)
 					}
 				} else {
 					hostData.Errors |= errRoutes
-					fmt.Printf("host:%s:routes:false\n", hostname)
+					fmt.Fprintf(out, "host:%s:routes:false\n", hostname)
 				}
 				
 				if cpha, err = ssh.GetCPHA(); err == nil {
 					hostData.Cpha = cpha
-					fmt.Printf("host:%s:cpha:true\n", hostname)
+					fmt.Fprintf(out, "host:%s:cpha:true\n", hostname)
 				} else {
 					hostData.Errors |= errCpha
-					fmt.Printf("host:%s:cpha:false\n", hostname)
+					fmt.Fprintf(out, "host:%s:cpha:false\n", hostname)
+				}
+
+				// a gateway without IPv6 just has none; failing to ask it leaves IPv6 out of the cluster comparison
+				if logical6, routes6, err := ssh.GetIPv6(); err == nil {
+					hostData.LogicalInterfaces	= append(hostData.LogicalInterfaces, logical6...)
+					hostData.Routes			= append(hostData.Routes, routes6...)
+					fmt.Fprintf(out, "host:%s:ipv6:true\n", hostname)
+				} else {
+					hostData.Errors |= errIPv6
+					fmt.Fprintf(out, "host:%s:ipv6:false\n", hostname)
 				}
 			} else {
 				hostData.Errors |= errOS
@@ -584,10 +1249,10 @@ func checkStandalone(hosts *HostsData, hostname string, user string, passw strin
 	}
 
 	if hostData.Errors == 0 {
-		fmt.Printf("host:%s:ok:true\n", hostname)
+		fmt.Fprintf(out, "host:%s:ok:true\n", hostname)
 		ok = true
 	} else {
-		fmt.Printf("host:%s:ok:false\n", hostname)
+		fmt.Fprintf(out, "host:%s:ok:false\n", hostname)
 		ok = false
 	}
 	
@@ -596,7 +1261,7 @@ func checkStandalone(hosts *HostsData, hostname string, user string, passw strin
 
 //
 //
-func checkCluster(hosts *HostsData, clustername string, user string, passw string, su_passw string, port int, flags uint, verbose int) (clusterData ClusterData, ok bool) {
+func checkCluster(out io.Writer, hosts *HostsData, clustername string, login Login, slots hostSlots, flags uint, verbose int) (clusterData ClusterData, ok bool) {
 	clusterData.Hosts		= make(map[string]HostData)
 	clusterData.Routes	= make(map[string]sshtool.Routes)
 	clusterData.Name		= clustername
@@ -604,91 +1269,154 @@ func checkCluster(hosts *HostsData, clustername string, user string, passw strin
 	
 	members := hosts.GetClusterMembers(clustername)
 
-	if len(members) == 2 {
-		hostData1, ok1 := checkStandalone(hosts, members[0], user, passw, su_passw, 22, verbose)
-		
-		clusterData.Hosts[members[0]] = hostData1
+	clusterData.Members = members
+
+	if len(members) >= 2 {
+		memberData := make([]HostData, len(members))
+		memberOk   := make([]bool, len(members))
+
+		// fetch the members in parallel; the output of each member is kept together
+		runConcurrent(out, len(members), func(index int, out io.Writer) {
+			slots.collect(func() {
+				memberData[index], memberOk[index] = checkStandalone(out, hosts, members[index], login, verbose)
+			})
+
+			if memberData[index].Cpha != nil {
+				fmt.Fprintf(out, "host:%s:cpha:\"%s\"\n", members[index], memberData[index].Cpha.Status)
+			} else {
+				fmt.Fprintf(out, "host:%s:cpha:null\n", members[index])
+			}
+		})
+
+		clusterData, ok = compareCluster(out, clusterData, memberData, memberOk, hosts.GetClusterIgnoredRoutes(clustername), verbose)
+	} else {
+		fmt.Fprintf(out, "ERROR: cluster does not contain at least two members\n")
+		clusterData.Errors |= errMembers
+		ok = false
+	}
 
-		if ok1 {
-			fmt.Printf("host:%s:cpha:\"%s\"\n", members[0], hostData1.Cpha.Status)
+	return clusterData, ok
+}
+
+//
+// compareCluster compares the routes, interfaces and HA state of the members of a cluster, or of the VAPs
+// of a VAP group, once they have been collected
+//
+func compareCluster(out io.Writer, clusterData ClusterData, memberData []HostData, memberOk []bool, ignoredRoutes RouteIgnoreRules, verbose int) (compared ClusterData, ok bool) {
+	clustername	:= clusterData.Name
+	members		:= clusterData.Members
+	ok				= true
+
+	allOk := true
+	ipv6Ok := true
+	memberRoutes := make(map[string]sshtool.Routes)
+	memberHosts := make(map[string]HostData)
+
+	for index, m := range members {
+		clusterData.Hosts[m] = memberData[index]
+
+		// a member which only lacks IPv6 is still compared, without IPv6
+		if memberData[index].Errors == errIPv6 {
+			ipv6Ok = false
+		} else if !memberOk[index] {
+			allOk = false
+		}
+	}
+
+	for _, m := range members {
+		if ipv6Ok {
+			memberHosts[m] = clusterData.Hosts[m]
 		} else {
-			fmt.Printf("host:%s:cpha:null\n", members[0])
+			memberHosts[m] = withoutIPv6(clusterData.Hosts[m])
 		}
 
-		hostData2, ok2 := checkStandalone(hosts, members[1], user, passw, su_passw, 22, verbose)
+		memberRoutes[m] = memberHosts[m].Routes
+	}
 
-		clusterData.Hosts[members[1]] = hostData2
+	if !allOk {
+		fmt.Fprintf(out, "cluster:%s:routes_match:false\n", clustername)
+		fmt.Fprintf(out, "cluster:%s:ok:false\n", clustername)
+		
+		ok = false
+	} else {
+		if !ipv6Ok {
+			fmt.Fprintf(out, "cluster:%s:ipv6_compared:false\n", clustername)
+		}
+
+		_, partialRoutes := CompareClusterRoutes(members, memberRoutes, verbose)
+		
+		mismatch := false
+		
+		for _, cr := range partialRoutes {
+			if rule, ignored := ignoredRoutes.MatchAll(cr.Present, cr.Route); ignored {
+				clusterData.Ignored = append(clusterData.Ignored, IgnoredRoute{cr, rule})
+			} else {
+				mismatch = true
+				clusterData.Mismatches = append(clusterData.Mismatches, cr)
 
-		if ok2 {
-			fmt.Printf("host:%s:cpha:\"%s\"\n", members[1], hostData2.Cpha.Status)
+				for _, m := range cr.Present {
+					clusterData.Routes[m] = append(clusterData.Routes[m], cr.Route)
+				}
+			}
+		}
+
+		if mismatch {
+			fmt.Fprintf(out, "cluster:%s:routes_match:false\n", clustername)
+			clusterData.Errors |= errRouteMismatch
 		} else {
-			fmt.Printf("host:%s:cpha:null\n", members[1])
+			fmt.Fprintf(out, "cluster:%s:routes_match:true\n", clustername)
 		}
 
-		if ok1 == false || ok2 == false {
-			fmt.Printf("cluster:%s:routes_match:false\n", clustername)
-			fmt.Printf("cluster:%s:ok:false\n", clustername)
-			
-			ok = false
+		clusterData.InterfaceMismatches = CompareClusterInterfaces(members, memberHosts, verbose)
+
+		if len(clusterData.InterfaceMismatches) > 0 {
+			fmt.Fprintf(out, "cluster:%s:interfaces_match:false\n", clustername)
+			clusterData.Errors |= errInterfaceMismatch
+			mismatch = true
 		} else {
-			_, host1OnlyRoutes, host2OnlyRoutes := CompareNetworks(hostData1.Routes, hostData2.Routes, verbose)
-			
-			ignoredRoutes := hosts.GetClusterIgnoredRoutes(clustername)
-			host1Mismatch := false
-			host2Mismatch := false
-			
-			var h1r sshtool.Routes
-			var h2r sshtool.Routes
-			
-			if len(host1OnlyRoutes) != 0 {
-				for _, r := range host1OnlyRoutes {
-					if _, ok := ignoredRoutes[r.Net]; !ok {
-						host1Mismatch = true
-						h1r = append(h1r, r)
-						//fmt.Printf("%-20s -> %-16s dev %s\n", r.Net, r.Gateway, r.Dev)
-						//break
-					}
-				}
-			}
-			
-			clusterData.Routes[members[0]] = h1r
-			
-			if len(host2OnlyRoutes) != 0 {
-				for _, r := range host2OnlyRoutes {
-					if _, ok := ignoredRoutes[r.Net]; !ok {
-						host2Mismatch = true
-						h2r = append(h2r, r)
-						//break
-					}
-				}
-			}
+			fmt.Fprintf(out, "cluster:%s:interfaces_match:true\n", clustername)
+		}
+		
+		cphaOk := true
 
-			clusterData.Routes[members[1]] = h2r
-	
-			if host1Mismatch || host2Mismatch {
-				fmt.Printf("cluster:%s:routes_match:false\n", clustername)
-				clusterData.Errors |= errRouteMismatch
-			} else {
-				fmt.Printf("cluster:%s:routes_match:true\n", clustername)
+		for _, m := range members {
+			if !cphaActive(clusterData.Hosts[m].Cpha) {
+				cphaOk = false
 			}
-			
-			if (strings.Contains(hostData1.Cpha.Status, "active") || strings.Contains(hostData1.Cpha.Status, "standby")) && (strings.Contains(hostData2.Cpha.Status, "active") || strings.Contains(hostData2.Cpha.Status, "standby")) {
-				if host1Mismatch || host2Mismatch {
-					fmt.Printf("cluster:%s:ok:false\n", clustername)
-					ok = false
-				} else {
-					fmt.Printf("cluster:%s:ok:true\n", clustername)
-				}
-			} else {
-				fmt.Printf("cluster:%s:ok:false\n", clustername)
-				clusterData.Errors |= errCphaStat
+		}
+
+		if cphaOk {
+			if mismatch {
+				fmt.Fprintf(out, "cluster:%s:ok:false\n", clustername)
 				ok = false
+			} else {
+				fmt.Fprintf(out, "cluster:%s:ok:true\n", clustername)
 			}
+		} else {
+			fmt.Fprintf(out, "cluster:%s:ok:false\n", clustername)
+			clusterData.Errors |= errCphaStat
+			ok = false
 		}
-	} else {
-		fmt.Printf("ERROR: cluster does not contain exactly two members\n")		
-		ok = false
 	}
 
 	return clusterData, ok
 }
+
+//
+// cphaActive tells if a cluster member is either active or standby
+//
+func cphaActive(cpha *sshtool.CphaData) (yes bool) {
+	return cpha != nil && (strings.Contains(cpha.Status, "active") || strings.Contains(cpha.Status, "standby"))
+}
+
+//
+//
+func memberOf(name string, members []string) (yes bool) {
+	for _, m := range members {
+		if m == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// sshtool can only log in with a password. Hosts with key or agent authentication are collected over an
+// SSH connection of our own instead, by running the commands whose output 'import' reads. The user must
+// have bash as login shell and CrossBeam VAPs can't be reached this way.
+//
+// sshtool has no way to run a command of ours either, so PasswordGateway adds the one connection of our
+// own its hosts need for the IPv6 information
+//
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+	"golang.org/x/crypto/ssh"
+)
+
+type ClientGateway struct {
+	conn					ConnSettings
+	client					*ssh.Client
+	ifconfig				string						// read once for both kinds of interfaces
+}
+
+type PasswordGateway struct {
+	*sshtool.SshAction
+
+	conn					ConnSettings
+	client					*ssh.Client					// opened when first needed
+}
+
+var errClientVAP = errors.New("CrossBeam VAPs can only be reached with password authentication")
+
+//
+//
+func NewClientGateway(conn ConnSettings) (gateway *ClientGateway) {
+	return &ClientGateway{conn: conn}
+}
+
+//
+//
+func (gateway *ClientGateway) Connect() (err error) {
+	gateway.client, err = dialGateway(gateway.conn)
+
+	return err
+}
+
+//
+//
+func (gateway *ClientGateway) run(command string) (output string, err error) {
+	return runSession(gateway.client, command, gateway.conn.Timeout)
+}
+
+//
+// GetOS tells Gaia from other Check Point systems by /etc/cp-release
+//
+func (gateway *ClientGateway) GetOS() (osclass sshtool.OsClass, ostype sshtool.OsType, err error) {
+	release, err := gateway.run("cat /etc/cp-release")
+	if err != nil {
+		return sshtool.OsClassUnknown, ostype, errors.New("not a Check Point gateway or no bash login shell")
+	}
+
+	if strings.Contains(release, "Gaia") {
+		return sshtool.OsClassGaia, ostype, nil
+	}
+
+	return sshtool.OsClassUnknown, ostype, nil
+}
+
+//
+// GetInfo returns the version from 'fw ver' and the platform from 'show asset system'; the platform is
+// left empty where clish does not know it
+//
+func (gateway *ClientGateway) GetInfo() (fwver string, platform string, err error) {
+	text, err := gateway.run("fw ver")
+	if err != nil {
+		return "", "", err
+	}
+
+	fwver = fwVerRegexp.FindString(text)
+
+	if text, err := gateway.run("clish -c \"show asset system\""); err == nil {
+		for _, line := range strings.Split(text, "\n") {
+			if i := strings.Index(line, ":"); i > 0 && strings.TrimSpace(line[:i]) == "Platform" {
+				platform = strings.TrimSpace(line[i + 1:])
+			}
+		}
+	}
+
+	return fwver, platform, nil
+}
+
+//
+// GetInterfaces returns the IPv4 addresses only, like sshtool; the IPv6 ones are collected on their own
+//
+func (gateway *ClientGateway) GetInterfaces() (logical sshtool.LogicalInterfaces, err error) {
+	if gateway.ifconfig, err = gateway.run("ifconfig"); err != nil {
+		return nil, err
+	}
+
+	logical, _ = parseIfconfig(gateway.ifconfig)
+
+	return removeIPv6(logical), nil
+}
+
+//
+//
+func (gateway *ClientGateway) GetPhyInterfaces(logical sshtool.LogicalInterfaces) (physical sshtool.PhysicalInterfaces, err error) {
+	if gateway.ifconfig == "" {
+		if gateway.ifconfig, err = gateway.run("ifconfig"); err != nil {
+			return nil, err
+		}
+	}
+
+	_, physical = parseIfconfig(gateway.ifconfig)
+
+	return physical, nil
+}
+
+//
+//
+func (gateway *ClientGateway) GetRoutes() (routes sshtool.Routes, err error) {
+	text, err := gateway.run("netstat -rn")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNetstat(text), nil
+}
+
+//
+//
+func (gateway *ClientGateway) GetCPHA() (cpha *sshtool.CphaData, err error) {
+	// cphaprob exits non zero when HA is not started, the output still tells why
+	text, err := gateway.run("cphaprob state")
+
+	if cpha = parseCphaprob(text); cpha == nil {
+		if err == nil {
+			err = errors.New("no HA state in the output of cphaprob")
+		}
+
+		return nil, err
+	}
+
+	return cpha, nil
+}
+
+//
+//
+func (gateway *ClientGateway) GetIPv6() (logical sshtool.LogicalInterfaces, routes sshtool.Routes, err error) {
+	return collectIPv6(gateway.run)
+}
+
+//
+//
+func (gateway *ClientGateway) GetVAPGroups() (vapGroups sshtool.VAPGroups, err error) {
+	return vapGroups, errClientVAP
+}
+
+//
+//
+func (gateway *ClientGateway) ConnectVAP(name string, index int) (err error) {
+	return errClientVAP
+}
+
+//
+//
+func (gateway *ClientGateway) DisconnectVAP() {
+}
+
+//
+//
+func (gateway *ClientGateway) Exit() {
+}
+
+//
+//
+func (gateway *ClientGateway) Disconnect() {
+	if gateway.client != nil {
+		gateway.client.Close()
+		gateway.client = nil
+	}
+}
+
+//
+//
+func (gateway *PasswordGateway) run(command string) (output string, err error) {
+	if gateway.client == nil {
+		if gateway.client, err = dialGateway(gateway.conn); err != nil {
+			return "", err
+		}
+	}
+
+	return runSession(gateway.client, command, gateway.conn.Timeout)
+}
+
+//
+//
+func (gateway *PasswordGateway) GetIPv6() (logical sshtool.LogicalInterfaces, routes sshtool.Routes, err error) {
+	return collectIPv6(gateway.run)
+}
+
+//
+//
+func (gateway *PasswordGateway) Disconnect() {
+	if gateway.client != nil {
+		gateway.client.Close()
+		gateway.client = nil
+	}
+
+	gateway.SshAction.Disconnect()
+}
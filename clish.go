@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// Gaia clish configuration as printed by 'clish -c "show configuration"'
+//
+
+package main
+
+import (
+	"net"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+)
+
+type ClishConfig struct {
+	Commands				[]ClishCommand
+}
+
+type ClishCommand struct {
+	Text					string						// the line as it was, quotes and all
+	Words					[]string
+}
+
+//
+//
+func ParseClishConfig(text string) (config *ClishConfig) {
+	config = &ClishConfig{}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		config.Commands = append(config.Commands, ClishCommand{Text: line, Words: strings.Fields(line)})
+	}
+
+	return config
+}
+
+//
+// Find returns the commands starting with the given words
+//
+func (config *ClishConfig) Find(prefix ...string) (commands []ClishCommand) {
+	if config == nil {
+		return commands
+	}
+
+	for _, c := range config.Commands {
+		if c.HasPrefix(prefix...) {
+			commands = append(commands, c)
+		}
+	}
+
+	return commands
+}
+
+//
+//
+func (command ClishCommand) HasPrefix(prefix ...string) (yes bool) {
+	if len(command.Words) < len(prefix) {
+		return false
+	}
+
+	for i, p := range prefix {
+		if command.Words[i] != p {
+			return false
+		}
+	}
+
+	return true
+}
+
+//
+// Interfaces returns the interfaces in the form sshtool reports them
+//
+//   set interface eth1 state on
+//   add interface eth1 vlan 111
+//   set interface eth1.111 ipv4-address 192.168.1.1 mask-length 24
+//
+func (config *ClishConfig) Interfaces() (logical sshtool.LogicalInterfaces, physical sshtool.PhysicalInterfaces) {
+	used := make(map[string]bool)
+
+	for _, cmd := range config.Find("set", "interface") {
+		if c := cmd.Words; len(c) >= 7 && c[3] == "ipv4-address" && c[5] == "mask-length" {
+			logical = append(logical, sshtool.LogicalInterface{IfName: c[2], IfIP: c[4] + "/" + c[6]})
+		}
+	}
+
+	for _, cmd := range config.Find("add", "interface") {
+		if c := cmd.Words; len(c) >= 5 && c[3] == "vlan" {
+			physical = append(physical, sshtool.PhysicalInterface{IfName: c[2], VLAN: c[4]})
+			used[c[2]] = true
+		}
+	}
+
+	for _, cmd := range config.Find("set", "interface") {
+		if c := cmd.Words; len(c) >= 5 && c[3] == "state" && c[4] == "on" && c[2] != "lo" && !strings.Contains(c[2], ".") && !used[c[2]] {
+			physical = append(physical, sshtool.PhysicalInterface{IfName: c[2]})
+			used[c[2]] = true
+		}
+	}
+
+	return logical, physical
+}
+
+//
+// Routes returns the static routes with a gateway; the device is the interface whose subnet holds the
+// gateway
+//
+//   set static-route 192.168.2.0/24 nexthop gateway address 192.168.1.10 priority 1 on
+//
+func (config *ClishConfig) Routes(logical sshtool.LogicalInterfaces) (routes sshtool.Routes) {
+	for _, cmd := range config.Find("set", "static-route") {
+		c := cmd.Words
+
+		if len(c) < 7 || c[3] != "nexthop" || c[4] != "gateway" || c[5] != "address" {
+			continue
+		}
+
+		dest := c[2]
+
+		if dest == "default" {
+			dest = "0.0.0.0/0"
+		}
+
+		_, ipNet, err := net.ParseCIDR(dest)
+		if err != nil {
+			continue
+		}
+
+		routes = append(routes, sshtool.NetworkRoute{Net: ipNet.String(), Gateway: c[6], Dev: routeDev(c[6], logical), IPNet: ipNet})
+	}
+
+	return routes
+}
+
+//
+//
+func routeDev(gateway string, logical sshtool.LogicalInterfaces) (dev string) {
+	ip := net.ParseIP(gateway)
+
+	for _, i := range logical {
+		if _, ipNet, err := net.ParseCIDR(i.IfIP); err == nil && ip != nil && ipNet.Contains(ip) {
+			return i.IfName
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+//
+// runParallel calls job for every index in [0, count) using at most 'parallel' workers. Each job writes
+// into its own buffer which is copied to 'out' in one piece when the job is done, so the output of one
+// job is never interleaved with the output of another
+//
+func runParallel(out io.Writer, count int, parallel int, job func(index int, out io.Writer)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel > count {
+		parallel = count
+	}
+
+	var mutex	sync.Mutex
+	var wg		sync.WaitGroup
+
+	jobs := make(chan int)
+
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for index := range jobs {
+				var buf bytes.Buffer
+
+				job(index, &buf)
+
+				mutex.Lock()
+				out.Write(buf.Bytes())
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		jobs <- index
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+//
+// runConcurrent calls job for every index in [0, count) at the same time and waits for all of them. The
+// output of each job is buffered and written to 'out' in index order once all jobs are done
+//
+func runConcurrent(out io.Writer, count int, job func(index int, out io.Writer)) {
+	var wg sync.WaitGroup
+
+	bufs := make([]bytes.Buffer, count)
+
+	for index := 0; index < count; index++ {
+		wg.Add(1)
+
+		go func(index int) {
+			defer wg.Done()
+
+			job(index, &bufs[index])
+		}(index)
+	}
+
+	wg.Wait()
+
+	for index := range bufs {
+		out.Write(bufs[index].Bytes())
+	}
+}
+
+//
+// hostSlots bounds how many hosts are collected at the same time, those of clusters included, so that
+// the members of the clusters collected by runParallel() don't go beyond --parallel. A nil hostSlots
+// doesn't bound anything
+//
+type hostSlots chan struct{}
+
+//
+//
+func newHostSlots(parallel int) (slots hostSlots) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	return make(hostSlots, parallel)
+}
+
+//
+// collect calls job once a slot is free, and frees it when job returns. Only jobs which collect a host
+// may take a slot: one which waits for others while holding a slot could wait forever
+//
+func (slots hostSlots) collect(job func()) {
+	if slots != nil {
+		slots <- struct{}{}
+		defer func() { <-slots }()
+	}
+
+	job()
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// clusters whose members are collected concurrently stay within the slots of --parallel
+//
+func TestHostSlots(t *testing.T) {
+	tests := []struct {
+		parallel		int
+		clusters		int
+		members		int
+	}{
+		{1,		4,		2},
+		{2,		4,		3},
+		{3,		2,		2},
+	}
+
+	for _, test := range tests {
+		var mutex			sync.Mutex
+		var running, most	int
+
+		slots := newHostSlots(test.parallel)
+
+		runParallel(ioutil.Discard, test.clusters, test.parallel, func(index int, out io.Writer) {
+			runConcurrent(out, test.members, func(index int, out io.Writer) {
+				slots.collect(func() {
+					mutex.Lock()
+					if running++; running > most {
+						most = running
+					}
+					mutex.Unlock()
+
+					time.Sleep(5 * time.Millisecond)
+					fmt.Fprintf(out, "member %d\n", index)
+
+					mutex.Lock()
+					running--
+					mutex.Unlock()
+				})
+			})
+		})
+
+		if most > test.parallel {
+			t.Errorf("parallel %d, %d clusters of %d: %d members collected at the same time", test.parallel, test.clusters, test.members, most)
+		}
+	}
+}
@@ -0,0 +1,791 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/mikejac/ssh.golang"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+//
+// Login holds what was given on the command line; it is the same for every host
+//
+type Login struct {
+	User					string
+	Port					int
+	Credentials			*CredentialStore			// passwords of hosts without a vault entry
+	Vault					*VaultData
+	Replay					string						// snapshot to replay instead of logging in
+}
+
+//
+// ConnSettings is the Login of a single host with the settings from the hosts file applied
+//
+type ConnSettings struct {
+	Login
+
+	Name					string						// name of the host in the hosts file
+	Host					string						// address of the host
+	Password				string
+	ExpertPassword		string
+	Auth					[]string					// authentication methods in order of preference
+	KeyFile				string
+	Timeout				time.Duration				// how long the host may keep us waiting; zero is forever
+	KnownHosts				string						// empty is ~/.ssh/known_hosts
+	HostKeyChecking		string						// yes, accept-new or no, for the gateway and its jump hosts; empty is accept-new
+
+	Jump					[]JumpHost					// jump hosts in the order they are passed
+	JumpAuth				[]string
+	JumpKeyFile			string
+	JumpKnownHosts		string						// empty is KnownHosts
+}
+
+const (
+	authPassword			= "password"
+	authKey				= "key"
+	authAgent				= "agent"
+
+	defaultKnownHosts		= "~/.ssh/known_hosts"
+
+	hostKeyYes				= "yes"					// only hosts of the known hosts file are accepted
+	hostKeyAcceptNew		= "accept-new"			// unknown hosts are added to the file, changed keys are refused
+	hostKeyNo				= "no"					// any host key is accepted
+
+	tunnelAcceptTimeout	= time.Minute				// for sshtool to connect to a tunnel without a timeout
+)
+
+var (
+	keyMutex				sync.Mutex
+	keySigners				= make(map[string]ssh.Signer)
+
+	agentMutex				sync.Mutex
+	agentClient			agent.Agent
+
+	knownHostsMutex		sync.Mutex
+	knownHostsCallbacks	= make(map[string]ssh.HostKeyCallback)	// by host key checking and file
+	knownHostsAdded		= make(map[string]ssh.PublicKey)		// by file and host, added by accept-new
+
+	errHostKeyAccepted		= errors.New("host key accepted")
+)
+
+//
+// newSshAction creates the sshtool session of a host which logs in with a password; sshtool knows no
+// other way to log in, see ClientGateway. sshtool neither knows jump hosts nor timeouts, so it is given
+// a tunnel which takes care of them, and it doesn't check host keys, so that is done before
+//
+func newSshAction(conn ConnSettings, verbose int) (action *sshtool.SshAction, err error) {
+	// sshtool writes its verbose output to stdout, which must carry nothing but a json document
+	if verboseOut != os.Stdout {
+		verbose = 0
+	}
+
+	if err = checkHostKey(conn); err != nil {
+		return nil, err
+	}
+
+	if len(conn.Jump) > 0 || conn.Timeout > 0 {
+		port, stop, err := tunnel(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		conn.Host = "127.0.0.1"
+		conn.Port = port
+
+		if action, err = sshtool.NewSshAction(conn.Host, conn.User, conn.Password, conn.ExpertPassword, conn.Port, verbose); err != nil {
+			stop()
+		}
+
+		return action, err
+	}
+
+	return sshtool.NewSshAction(conn.Host, conn.User, conn.Password, conn.ExpertPassword, conn.Port, verbose)
+}
+
+//
+// tunnel opens a local port which is forwarded to the gateway, through the jump hosts if it has any. The
+// port accepts a single connection, the one sshtool makes. When nothing has been sent either way for the
+// timeout of the host the gateway is taken to be hanging and the connection is cut.
+//
+// The tunnel is closed when sshtool has not connected within the timeout, or by calling 'stop'
+//
+func tunnel(conn ConnSettings) (port int, stop func(), err error) {
+	remote, err := dialTarget(conn)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		remote.Close()
+		return 0, nil, err
+	}
+
+	accept := conn.Timeout
+
+	if accept == 0 {
+		accept = tunnelAcceptTimeout
+	}
+
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(accept))
+
+	go func() {
+		local, err := listener.Accept()
+		listener.Close()
+
+		if err != nil {
+			remote.Close()
+			return
+		}
+
+		relay(local, remote, conn.Timeout)
+	}()
+
+	// a closed listener fails the Accept() above, which closes the connection to the gateway
+	return listener.Addr().(*net.TCPAddr).Port, func() { listener.Close() }, nil
+}
+
+//
+// relay copies between two connections until either side closes or, with a timeout, until both have been
+// quiet for that long
+//
+func relay(local net.Conn, remote net.Conn, timeout time.Duration) {
+	var idle *time.Timer
+
+	closeBoth := func() {
+		local.Close()
+		remote.Close()
+	}
+
+	if timeout > 0 {
+		idle = time.AfterFunc(timeout, closeBoth)
+	}
+
+	copyConn := func(dst net.Conn, src net.Conn) {
+		b := make([]byte, 32 * 1024)
+
+		for {
+			n, err := src.Read(b)
+
+			if n > 0 {
+				if idle != nil {
+					idle.Reset(timeout)
+				}
+				if _, err := dst.Write(b[:n]); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		closeBoth()
+	}
+
+	go copyConn(remote, local)
+	copyConn(local, remote)
+
+	if idle != nil {
+		idle.Stop()
+	}
+}
+
+//
+// dialTarget opens the TCP connection to the SSH port of a gateway, through its jump hosts if it has any
+//
+func dialTarget(conn ConnSettings) (c net.Conn, err error) {
+	target := net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port))
+
+	if len(conn.Jump) == 0 {
+		return net.DialTimeout("tcp", target, conn.Timeout)
+	}
+
+	client, err := jumpClient(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if c, err = dialVia(client, target, conn.Timeout); err != nil {
+		// the cached connection to the jump host may have died since it was used last
+		forgetJumpClient(conn.Jump)
+
+		if client, err = jumpClient(conn); err != nil {
+			return nil, err
+		}
+		if c, err = dialVia(client, target, conn.Timeout); err != nil {
+			return nil, fmt.Errorf("%s via %s: %s", target, jumpChain(conn.Jump), err.Error())
+		}
+	}
+
+	return c, nil
+}
+
+//
+// dialVia opens a TCP connection through an SSH connection. ssh.Client has no timeout for this, so a jump
+// host which doesn't answer is left behind after the timeout
+//
+func dialVia(via *ssh.Client, addr string, timeout time.Duration) (c net.Conn, err error) {
+	if timeout == 0 {
+		return via.Dial("tcp", addr)
+	}
+
+	type dialed struct {
+		c					net.Conn
+		err				error
+	}
+
+	done := make(chan dialed, 1)
+
+	go func() {
+		c, err := via.Dial("tcp", addr)
+		done <- dialed{c, err}
+	}()
+
+	select {
+	case d := <-done:
+		return d.c, d.err
+	case <-time.After(timeout):
+		// a connection which comes through too late is closed
+		go func() {
+			if d := <-done; d.c != nil {
+				d.c.Close()
+			}
+		}()
+
+		return nil, fmt.Errorf("%s: connect timed out", addr)
+	}
+}
+
+//
+// dialSSH makes an SSH connection to 'addr', directly or through 'via'. The timeout of the configuration
+// covers the TCP connect and the handshake; ssh.Dial only applies it to the former
+//
+func dialSSH(via *ssh.Client, addr string, config *ssh.ClientConfig) (client *ssh.Client, err error) {
+	var c net.Conn
+
+	if via == nil {
+		c, err = net.DialTimeout("tcp", addr, config.Timeout)
+	} else {
+		c, err = dialVia(via, addr, config.Timeout)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var timer *time.Timer
+
+	if config.Timeout > 0 {
+		timer = time.AfterFunc(config.Timeout, func() { c.Close() })
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(c, addr, config)
+
+	if timer != nil && !timer.Stop() {
+		err = fmt.Errorf("%s: handshake timed out", addr)
+	}
+
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+//
+// hostKeyCallback checks host keys against a known_hosts file, ~/.ssh/known_hosts when none is given,
+// the way ssh does with StrictHostKeyChecking:
+//
+//   yes         only hosts of the file are accepted; without a file which can be read no host is
+//   accept-new  hosts which are not in the file are added to it, the file is created when missing;
+//               a host whose key differs from the one in the file is refused (the default)
+//   no          any host key is accepted
+//
+func hostKeyCallback(file string, checking string) (callback ssh.HostKeyCallback, err error) {
+	if checking == hostKeyNo {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	if checking == "" {
+		checking = hostKeyAcceptNew
+	}
+
+	knownHostsMutex.Lock()
+	defer knownHostsMutex.Unlock()
+
+	if file == "" {
+		file = defaultKnownHosts
+	}
+
+	if callback, ok := knownHostsCallbacks[checking + " " + file]; ok {
+		return callback, nil
+	}
+
+	path := expandHome(file)
+
+	if checking == hostKeyAcceptNew {
+		if err = createKnownHosts(path); err != nil {
+			return nil, fmt.Errorf("no known hosts: %s", err.Error())
+		}
+	}
+
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("no known hosts: %s (set host_key_checking to accept-new or no to log in anyway)", err.Error())
+	}
+
+	callback = func(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+		err = check(hostname, remote, key)
+
+		// an unknown host has no keys in the file, a changed one has
+		if keyErr, ok := err.(*knownhosts.KeyError); ok && len(keyErr.Want) == 0 && checking == hostKeyAcceptNew {
+			return addHostKey(path, hostname, key)
+		}
+
+		if err != nil {
+			return fmt.Errorf("host key of %s not accepted by %s: %s", hostname, file, err.Error())
+		}
+
+		return nil
+	}
+
+	knownHostsCallbacks[checking + " " + file] = callback
+
+	return callback, nil
+}
+
+//
+// createKnownHosts creates an empty known_hosts file, and its directory, unless it exists
+//
+func createKnownHosts(path string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE | os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+//
+// addHostKey appends the key of a host to a known_hosts file. The file was read before the host was
+// added, so the keys added since are kept to refuse a host whose key changes while ckptool runs
+//
+func addHostKey(path string, hostname string, key ssh.PublicKey) (err error) {
+	knownHostsMutex.Lock()
+	defer knownHostsMutex.Unlock()
+
+	address := knownhosts.Normalize(hostname)
+
+	if added, found := knownHostsAdded[path + " " + address]; found {
+		if !bytes.Equal(added.Marshal(), key.Marshal()) {
+			return fmt.Errorf("host key of %s changed since it was added to %s", hostname, path)
+		}
+
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND | os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if _, err = fmt.Fprintln(f, knownhosts.Line([]string{address}, key)); err != nil {
+		return err
+	}
+
+	knownHostsAdded[path + " " + address] = key
+
+	fmt.Fprintf(os.Stderr, "WARNING: host key of %s added to %s\n", hostname, path)
+
+	return nil
+}
+
+//
+// runSession runs a command in a new session of an SSH connection. A command which takes longer than the
+// timeout closes the connection, as the gateway can't be relied on to end the session
+//
+func runSession(client *ssh.Client, command string, timeout time.Duration) (output string, err error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+
+	defer session.Close()
+
+	var timer *time.Timer
+
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, func() { client.Close() })
+	}
+
+	b, err := session.Output(command)
+
+	if timer != nil && !timer.Stop() {
+		return "", fmt.Errorf("'%s' timed out", command)
+	}
+
+	return string(b), err
+}
+
+//
+// passwordOnly tells if a host logs in with nothing but a password, the only login sshtool can do
+//
+func passwordOnly(conn ConnSettings) (yes bool) {
+	return len(conn.Auth) == 1 && conn.Auth[0] == authPassword
+}
+
+//
+// runCommand runs a single command on a gateway in a session of its own, for output sshtool has no
+// function for
+//
+func runCommand(conn ConnSettings, command string) (output string, err error) {
+	client, err := dialGateway(conn)
+	if err != nil {
+		return "", err
+	}
+
+	defer client.Close()
+
+	return runSession(client, command, conn.Timeout)
+}
+
+//
+// dialGateway opens an SSH connection of our own to a gateway, through its jump hosts if it has any
+//
+func dialGateway(conn ConnSettings) (client *ssh.Client, err error) {
+	methods, err := authMethods(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := hostKeyCallback(conn.KnownHosts, conn.HostKeyChecking)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:				conn.User,
+		Auth:				methods,
+		HostKeyCallback:	callback,
+		Timeout:			conn.Timeout,
+	}
+
+	var via *ssh.Client
+
+	if len(conn.Jump) > 0 {
+		if via, err = jumpClient(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	return dialSSH(via, net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port)), config)
+}
+
+//
+// checkHostKey checks the host key of a gateway which sshtool is about to log in to. The handshake is
+// given up as soon as the key has been accepted, before anything is sent to the gateway
+//
+func checkHostKey(conn ConnSettings) (err error) {
+	if conn.HostKeyChecking == hostKeyNo {
+		return nil
+	}
+
+	callback, err := hostKeyCallback(conn.KnownHosts, conn.HostKeyChecking)
+	if err != nil {
+		return err
+	}
+
+	accepted := false
+
+	config := &ssh.ClientConfig{
+		User:				conn.User,
+		HostKeyCallback:	func(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+			if err = callback(hostname, remote, key); err != nil {
+				return err
+			}
+
+			accepted = true
+
+			return errHostKeyAccepted
+		},
+		Timeout:			conn.Timeout,
+	}
+
+	var via *ssh.Client
+
+	if len(conn.Jump) > 0 {
+		if via, err = jumpClient(conn); err != nil {
+			return err
+		}
+	}
+
+	client, err := dialSSH(via, net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port)), config)
+	if client != nil {
+		client.Close()
+	}
+
+	if accepted {
+		return nil
+	}
+
+	return err
+}
+
+//
+// fetchConfiguration returns 'show configuration' of a gateway, or the captured one when replaying
+//
+func fetchConfiguration(conn ConnSettings) (text string, err error) {
+	if conn.Replay != "" {
+		gateway, err := NewReplayGateway(conn.Replay, conn.Name)
+		if err != nil {
+			return "", err
+		}
+		if gateway.host.ClishConfig == "" {
+			return "", errNotCaptured
+		}
+
+		return gateway.host.ClishConfig, nil
+	}
+
+	return runClish(conn, "show configuration")
+}
+
+//
+// runClish runs a clish command through clish first and then as is, for users whose login shell is
+// clish. Empty output is an error
+//
+func runClish(conn ConnSettings, command string) (output string, err error) {
+	for _, c := range []string{"clish -c \"" + command + "\"", command} {
+		if output, err = runCommand(conn, c); err == nil && strings.TrimSpace(output) != "" {
+			return output, nil
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("'%s' returned nothing", command)
+	}
+
+	return "", err
+}
+
+//
+// commandFailed tells if an error is that of a command which ran and failed, rather than of the session
+//
+func commandFailed(err error) (yes bool) {
+	switch err.(type) {
+	case *ssh.ExitError, *ssh.ExitMissingError:
+		return true
+	}
+
+	return false
+}
+
+//
+// passwords looks up the passwords of a host in the vault, host name first and then the sections of the
+// host, cluster sections before inventory sections, and falls back to the credential sources. The SSH
+// password is only needed for password logins and the expert password only by sshtool; a password which
+// is needed but can't be found is an error
+//
+func (login Login) passwords(name string, sections []string, auth []string) (password string, expertPassword string, err error) {
+	var ok bool
+
+	keys := append([]string{name}, sections...)
+
+	if memberOf(authPassword, auth) {
+		if password, ok = login.password(credSSH, "SSH Password: ", keys); !ok {
+			return "", "", fmt.Errorf("no SSH password available for %s", name)
+		}
+	}
+
+	if len(auth) == 1 && auth[0] == authPassword {
+		if expertPassword, ok = login.password(credExpert, "Expert Password: ", keys); !ok {
+			return "", "", fmt.Errorf("no expert password available for %s", name)
+		}
+	}
+
+	return password, expertPassword, nil
+}
+
+//
+//
+func (login Login) password(kind string, prompt string, keys []string) (password string, ok bool) {
+	if password, _, ok := login.Vault.Lookup(kind, keys...); ok {
+		return password, true
+	}
+
+	if login.Credentials != nil {
+		return login.Credentials.Get(kind, prompt)
+	}
+
+	return "", false
+}
+
+//
+//
+func authMethods(conn ConnSettings) (methods []ssh.AuthMethod, err error) {
+	for _, a := range conn.Auth {
+		switch a {
+		case authKey:
+			if conn.KeyFile == "" {
+				return nil, fmt.Errorf("key authentication configured for %s but no ssh_key given", conn.Name)
+			}
+
+			signer, err := loadKey(conn.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+
+			methods = append(methods, ssh.PublicKeys(signer))
+		case authAgent:
+			client, err := sshAgent()
+			if err != nil {
+				return nil, err
+			}
+
+			methods = append(methods, ssh.PublicKeysCallback(client.Signers))
+		case authPassword:
+			password := conn.Password
+
+			// Gaia may only offer keyboard-interactive, which asks for nothing but the password
+			methods = append(methods, ssh.Password(password), ssh.KeyboardInteractive(func(user string, instruction string, questions []string, echos []bool) (answers []string, err error) {
+				for range questions {
+					answers = append(answers, password)
+				}
+
+				return answers, nil
+			}))
+		}
+	}
+
+	return methods, nil
+}
+
+//
+// ParseAuth parses a list of authentication methods like 'key+password'
+//
+func ParseAuth(val string) (auth []string, err error) {
+	for _, a := range strings.Split(val, "+") {
+		a = strings.TrimSpace(a)
+
+		if a != authPassword && a != authKey && a != authAgent {
+			return nil, fmt.Errorf("unknown authentication method '%s'", a)
+		}
+
+		auth = append(auth, a)
+	}
+
+	return auth, nil
+}
+
+//
+// loadKey reads a private key, asking for the passphrase if it is encrypted. Keys are only read
+// once as several hosts are usually collected with the same key
+//
+func loadKey(file string) (signer ssh.Signer, err error) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if signer, ok := keySigners[file]; ok {
+		return signer, nil
+	}
+
+	b, err := ioutil.ReadFile(expandHome(file))
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err = ssh.ParsePrivateKey(b)
+
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		passphrase, ok := Credentials("Passphrase for " + file + ": ")
+		if !ok {
+			return nil, fmt.Errorf("no passphrase for %s", file)
+		}
+
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+
+	keySigners[file] = signer
+
+	return signer, nil
+}
+
+//
+//
+func sshAgent() (client agent.Agent, err error) {
+	agentMutex.Lock()
+	defer agentMutex.Unlock()
+
+	if agentClient != nil {
+		return agentClient, nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("agent authentication configured but SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh-agent: %s", err.Error())
+	}
+
+	agentClient = agent.NewClient(conn)
+
+	return agentClient, nil
+}
+
+//
+//
+func expandHome(file string) (path string) {
+	if strings.HasPrefix(file, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, file[2:])
+		}
+	}
+
+	return file
+}
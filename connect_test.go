@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"golang.org/x/crypto/ssh"
+)
+
+//
+// accept-new adds unknown hosts and refuses changed keys, yes only accepts what is in the file and no
+// accepts anything
+//
+func TestHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ckptool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keys := make([]ssh.PublicKey, 2)
+
+	for i := range keys {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys[i], err = ssh.NewPublicKey(pub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file	:= filepath.Join(dir, "ssh", "known_hosts")
+	remote	:= &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+
+	if _, err = hostKeyCallback(file, hostKeyYes); err == nil {
+		t.Errorf("yes accepted a missing known hosts file")
+	}
+
+	tests := []struct {
+		checking		string
+		hostname		string
+		key			ssh.PublicKey
+		ok				bool
+	}{
+		{hostKeyAcceptNew,	"fw1:22",		keys[0],	true},			// added
+		{hostKeyAcceptNew,	"fw1:22",		keys[0],	true},
+		{hostKeyAcceptNew,	"fw1:22",		keys[1],	false},			// changed
+		{hostKeyYes,		"fw1:22",		keys[0],	true},			// added to the file by accept-new
+		{hostKeyYes,		"fw2:22",		keys[0],	false},
+		{hostKeyNo,		"fw1:22",		keys[1],	true},
+	}
+
+	for _, test := range tests {
+		callback, err := hostKeyCallback(file, test.checking)
+		if err != nil {
+			t.Fatalf("%s: %s", test.checking, err.Error())
+		}
+
+		if err = callback(test.hostname, remote, test.key); (err == nil) != test.ok {
+			t.Errorf("%s %s: got %v, want ok %t", test.checking, test.hostname, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// Prometheus text exposition format; see https://prometheus.io/docs/instrumenting/exposition_formats/
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type metricFamily struct {
+	name					string
+	help					string
+	samples				[]string
+}
+
+type MetricSet struct {
+	families				[]*metricFamily
+	index					map[string]*metricFamily
+}
+
+type ExporterData struct {
+	mutex					sync.Mutex
+	metrics				[]byte
+	collect				func() (hostData []HostData, clusterData []ClusterData, clusterOk []bool)
+}
+
+//
+//
+func NewMetricSet() (metrics *MetricSet) {
+	metrics = &MetricSet{
+		index: make(map[string]*metricFamily),
+	}
+
+	return metrics
+}
+
+//
+// Add adds a gauge sample; 'labels' holds label names and values in pairs
+//
+func (metrics *MetricSet) Add(name string, help string, value float64, labels ...string) {
+	family, ok := metrics.index[name]
+	if !ok {
+		family = &metricFamily{name: name, help: help}
+
+		metrics.families	= append(metrics.families, family)
+		metrics.index[name]	= family
+	}
+
+	var l []string
+
+	for i := 0; i + 1 < len(labels); i += 2 {
+		l = append(l, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i + 1])))
+	}
+
+	sample := name
+
+	if len(l) > 0 {
+		sample += "{" + strings.Join(l, ",") + "}"
+	}
+
+	family.samples = append(family.samples, fmt.Sprintf("%s %g", sample, value))
+}
+
+//
+//
+func (metrics *MetricSet) Render(writer io.Writer) {
+	for _, family := range metrics.families {
+		fmt.Fprintf(writer, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(writer, "# TYPE %s gauge\n", family.name)
+
+		for _, s := range family.samples {
+			fmt.Fprintln(writer, s)
+		}
+	}
+}
+
+//
+//
+func escapeLabel(value string) (escaped string) {
+	escaped = strings.Replace(value, "\\", "\\\\", -1)
+	escaped = strings.Replace(escaped, "\"", "\\\"", -1)
+	escaped = strings.Replace(escaped, "\n", "\\n", -1)
+
+	return escaped
+}
+
+//
+//
+func boolGauge(b bool) (value float64) {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+//
+// AddHostMetrics adds the metrics of a single host; 'cluster' is empty for standalone hosts
+//
+func (metrics *MetricSet) AddHostMetrics(hostData HostData, cluster string) {
+	metrics.Add("ckptool_host_up", "Whether ckptool could connect to the host.", boolGauge((hostData.Errors & errConnect) == 0), "host", hostData.Name, "cluster", cluster)
+
+	for _, e := range hostErrorNames {
+		metrics.Add("ckptool_host_error", "Host error bits from the last collection.", boolGauge((hostData.Errors & e.bit) != 0), "host", hostData.Name, "cluster", cluster, "error", e.name)
+	}
+
+	metrics.Add("ckptool_host_routes", "Number of routes on the host.", float64(len(hostData.Routes)), "host", hostData.Name, "cluster", cluster)
+	metrics.Add("ckptool_host_logical_interfaces", "Number of logical interfaces on the host.", float64(len(hostData.LogicalInterfaces)), "host", hostData.Name, "cluster", cluster)
+	metrics.Add("ckptool_host_physical_interfaces", "Number of physical interfaces and VLANs on the host.", float64(len(hostData.PhysicalInterfaces)), "host", hostData.Name, "cluster", cluster)
+
+	if hostData.Cpha != nil {
+		metrics.Add("ckptool_host_cpha_state", "CPHA state of the host as reported by cphaprob.", 1, "host", hostData.Name, "cluster", cluster, "state", hostData.Cpha.Status)
+	}
+	if hostData.FwVer != "" {
+		metrics.Add("ckptool_host_info", "Firewall version and platform of the host.", 1, "host", hostData.Name, "cluster", cluster, "fwver", hostData.FwVer, "platform", hostData.Platform)
+	}
+}
+
+//
+//
+func (metrics *MetricSet) AddClusterMetrics(clusterData ClusterData, ok bool) {
+	metrics.Add("ckptool_cluster_ok", "Whether all checks of the cluster passed.", boolGauge(ok), "cluster", clusterData.Name)
+	metrics.Add("ckptool_cluster_members", "Number of members of the cluster.", float64(len(clusterData.Members)), "cluster", clusterData.Name)
+
+	for _, e := range clusterErrorNames {
+		metrics.Add("ckptool_cluster_error", "Cluster error bits from the last collection.", boolGauge((clusterData.Errors & e.bit) != 0), "cluster", clusterData.Name, "error", e.name)
+	}
+
+	metrics.Add("ckptool_cluster_mismatched_routes", "Number of routes not present on all cluster members.", float64(len(clusterData.Mismatches)), "cluster", clusterData.Name)
+	metrics.Add("ckptool_cluster_ignored_routes", "Number of mismatched routes matched by an ignore rule.", float64(len(clusterData.Ignored)), "cluster", clusterData.Name)
+	metrics.Add("ckptool_cluster_interface_mismatches", "Number of interface mismatches between cluster members.", float64(len(clusterData.InterfaceMismatches)), "cluster", clusterData.Name)
+
+	for _, m := range clusterData.Members {
+		metrics.Add("ckptool_cluster_member_mismatched_routes", "Number of mismatched routes present on the cluster member.", float64(len(clusterData.Routes[m])), "cluster", clusterData.Name, "host", m)
+
+		metrics.AddHostMetrics(clusterData.Hosts[m], clusterData.Name)
+	}
+}
+
+//
+// NewExporter creates an exporter which calls 'collect' to gather the data for the metrics
+//
+func NewExporter(collect func() (hostData []HostData, clusterData []ClusterData, clusterOk []bool)) (exporter *ExporterData) {
+	exporter = &ExporterData{
+		collect: collect,
+	}
+
+	return exporter
+}
+
+//
+// Run collects the metrics every 'interval' and serves the latest result on /metrics
+//
+func (exporter *ExporterData) Run(listen string, interval time.Duration) (err error) {
+	go func() {
+		for {
+			exporter.update()
+
+			time.Sleep(interval)
+		}
+	}()
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		exporter.mutex.Lock()
+		metrics := exporter.metrics
+		exporter.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(metrics)
+	})
+
+	return http.ListenAndServe(listen, nil)
+}
+
+//
+//
+func (exporter *ExporterData) update() {
+	start := time.Now()
+
+	hostData, clusterData, clusterOk := exporter.collect()
+
+	metrics := NewMetricSet()
+
+	for _, hd := range hostData {
+		metrics.AddHostMetrics(hd, "")
+	}
+	for index, cd := range clusterData {
+		metrics.AddClusterMetrics(cd, clusterOk[index])
+	}
+
+	metrics.Add("ckptool_collection_duration_seconds", "Time taken by the last collection.", time.Since(start).Seconds())
+	metrics.Add("ckptool_collection_timestamp_seconds", "Unix time of the end of the last collection.", float64(time.Now().Unix()))
+
+	var buf bytes.Buffer
+
+	metrics.Render(&buf)
+
+	exporter.mutex.Lock()
+	exporter.metrics = buf.Bytes()
+	exporter.mutex.Unlock()
+}
@@ -0,0 +1,368 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// migrate output for the Gaia REST API and for Ansible with the check_point.gaia collection. Both are
+// built from the same list of operations; the Ansible modules take the API parameters with '_' for '-'
+//
+//   https://sc1.checkpoint.com/documents/latest/GaiaAPIs/
+//   https://galaxy.ansible.com/check_point/gaia
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type GaiaOperation struct {
+	Name					string						// description, used as the Ansible task name
+	Command				string						// Gaia API command
+	Module					string						// Ansible module in check_point.gaia
+	Payload				map[string]interface{}
+}
+
+type gaiaBatch struct {
+	Host					string						`json:"host"`
+	Requests				[]gaiaRequest				`json:"requests"`
+}
+
+type gaiaRequest struct {
+	Command				string						`json:"command"`
+	Payload				map[string]interface{}		`json:"payload"`
+}
+
+//
+// GaiaOperations returns the API calls which rebuild the hostname, DNS, interfaces, bonds and static
+// routes of a host, in the order they must be applied. IPv6 static routes and next hops which are only
+// an interface are left out, as is the rest of what the clish output migrates; GaiaLeftOut() tells what
+// that is
+//
+func GaiaOperations(hostData HostData) (ops []GaiaOperation) {
+	config := ParseClishConfig(hostData.ClishConfig)
+
+	for _, c := range config.Find("set", "hostname") {
+		if len(c.Words) == 3 {
+			ops = append(ops, GaiaOperation{"hostname " + c.Words[2], "set-hostname", "cp_gaia_hostname", map[string]interface{}{"name": c.Words[2]}})
+		}
+	}
+
+	dns := make(map[string]interface{})
+
+	for _, c := range config.Find("set", "dns") {
+		if len(c.Words) == 4 {
+			dns[c.Words[2]] = c.Words[3]				// primary, secondary, tertiary, suffix
+		}
+	}
+
+	if len(dns) > 0 {
+		ops = append(ops, GaiaOperation{"DNS", "set-dns", "cp_gaia_dns", dns})
+	}
+
+	addresses := make(map[string][]string)
+
+	for _, i := range hostData.LogicalInterfaces {
+		if p := strings.Split(i.IfIP, "/"); len(p) == 2 {
+			addresses[logicalKey(i)] = p
+		}
+	}
+
+	bonds := gaiaBonds(config)
+	used := make(map[string]bool)
+
+	for _, i := range hostData.PhysicalInterfaces {
+		if used[i.IfName] || bonds[i.IfName] != nil {
+			continue
+		}
+
+		used[i.IfName] = true
+
+		payload := map[string]interface{}{"name": i.IfName, "enabled": true}
+		gaiaAddress(payload, "ipv4", addresses[i.IfName])
+		gaiaAddress(payload, "ipv6", addresses[i.IfName + " ipv6"])
+
+		ops = append(ops, GaiaOperation{"interface " + i.IfName, "set-physical-interface", "cp_gaia_physical_interface", payload})
+	}
+
+	// the members must exist before the bond and the bond before its VLANs
+	for _, c := range config.Find("add", "bonding", "group") {
+		if len(c.Words) != 4 || bonds["bond" + c.Words[3]] == nil {
+			continue
+		}
+
+		name := "bond" + c.Words[3]
+		payload := bonds[name]
+		gaiaAddress(payload, "ipv4", addresses[name])
+		gaiaAddress(payload, "ipv6", addresses[name + " ipv6"])
+
+		ops = append(ops, GaiaOperation{"bond " + name, "add-bond-interface", "cp_gaia_bond_interface", payload})
+	}
+
+	for _, i := range hostData.PhysicalInterfaces {
+		if i.VLAN == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(i.VLAN)
+		if err != nil {
+			continue
+		}
+
+		payload := map[string]interface{}{"parent": i.IfName, "id": id}
+		gaiaAddress(payload, "ipv4", addresses[i.IfName + "." + i.VLAN])
+		gaiaAddress(payload, "ipv6", addresses[i.IfName + "." + i.VLAN + " ipv6"])
+
+		ops = append(ops, GaiaOperation{"VLAN " + i.IfName + "." + i.VLAN, "add-vlan-interface", "cp_gaia_vlan_interface", payload})
+	}
+
+	for _, r := range staticRoutes(hostData, config) {
+		ip, ipNet, err := net.ParseCIDR(r.Net)
+
+		// set-static-route only takes IPv4 routes
+		if err != nil || ip.To4() == nil {
+			continue
+		}
+
+		payload := map[string]interface{}{"type": "gateway"}
+
+		// the default route has no mask length, its address is 'default'
+		if ones, _ := ipNet.Mask.Size(); ones == 0 {
+			payload["address"] = "default"
+		} else {
+			payload["address"]		= ipNet.IP.String()
+			payload["mask-length"]	= ones
+		}
+
+		var nextHops []map[string]interface{}
+
+		for _, h := range r.NextHops {
+			// the API only knows next hops by address
+			if h.Gateway == "" {
+				continue
+			}
+
+			nextHop := map[string]interface{}{"gateway": h.Gateway}
+
+			if h.Priority > 0 {
+				nextHop["priority"] = h.Priority
+			}
+
+			nextHops = append(nextHops, nextHop)
+		}
+
+		if r.Discard != "" {
+			payload["type"] = r.Discard
+		} else if len(nextHops) > 0 {
+			payload["next-hop"] = nextHops
+		} else {
+			continue
+		}
+
+		ops = append(ops, GaiaOperation{"static route " + r.Net, "set-static-route", "cp_gaia_static_route", payload})
+	}
+
+	return ops
+}
+
+//
+// GaiaLeftOut returns the commands of the clish output which GaiaOperations() has no API call for, by
+// configuration group
+//
+func GaiaLeftOut(hostData HostData) (leftOut []ConfigGroup) {
+	for _, group := range MigrationConfig(hostData, ParseClishConfig(hostData.ClishConfig)) {
+		var commands []string
+
+		for _, c := range group.Commands {
+			if !strings.HasPrefix(c, "#") && !gaiaCovered(c) {
+				commands = append(commands, c)
+			}
+		}
+
+		if len(commands) > 0 {
+			leftOut = append(leftOut, ConfigGroup{Name: group.Name, Commands: commands})
+		}
+	}
+
+	return leftOut
+}
+
+//
+// gaiaCovered tells if GaiaOperations() has an API call for a clish command
+//
+func gaiaCovered(command string) (yes bool) {
+	w := strings.Fields(command)
+
+	switch {
+	case len(w) > 1 && w[0] == "set" && (w[1] == "hostname" || w[1] == "dns"):
+		return true
+	case len(w) > 4 && w[0] == "set" && w[1] == "static-route":
+		return len(w) < 6 || w[4] != "gateway" || w[5] != "logical"
+	case len(w) > 3 && w[0] == "add" && w[1] == "bonding":
+		return true
+	case len(w) > 4 && w[0] == "set" && w[1] == "bonding":
+		return w[4] == "mode"
+	case len(w) > 3 && w[0] == "set" && w[1] == "interface":
+		return w[3] == "state" || w[3] == "ipv4-address" || w[3] == "ipv6-address"
+	case len(w) > 3 && w[0] == "add" && w[1] == "interface":
+		return w[3] == "vlan"
+	}
+
+	return false
+}
+
+//
+// gaiaBonds returns the add-bond-interface payloads of the bonds of the configuration, by bond name,
+// with their members and mode
+//
+//   add bonding group 1 interface eth2
+//   set bonding group 1 mode 8023AD
+//
+func gaiaBonds(config *ClishConfig) (bonds map[string]map[string]interface{}) {
+	bonds = make(map[string]map[string]interface{})
+
+	for _, c := range config.Find("add", "bonding", "group") {
+		if len(c.Words) < 4 {
+			continue
+		}
+
+		id, err := strconv.Atoi(c.Words[3])
+		if err != nil {
+			continue
+		}
+
+		payload, found := bonds["bond" + c.Words[3]]
+		if !found {
+			payload = map[string]interface{}{"id": id, "members": []string{}}
+			bonds["bond" + c.Words[3]] = payload
+		}
+
+		if len(c.Words) == 6 && c.Words[4] == "interface" {
+			payload["members"] = append(payload["members"].([]string), c.Words[5])
+		}
+	}
+
+	for _, c := range config.Find("set", "bonding", "group") {
+		if len(c.Words) == 6 && c.Words[4] == "mode" && bonds["bond" + c.Words[3]] != nil {
+			bonds["bond" + c.Words[3]]["mode"] = c.Words[5]
+		}
+	}
+
+	return bonds
+}
+
+//
+//
+func gaiaAddress(payload map[string]interface{}, family string, address []string) {
+	if len(address) != 2 || net.ParseIP(address[0]) == nil {
+		return
+	}
+
+	if ones, err := strconv.Atoi(address[1]); err == nil {
+		payload[family + "-address"]		= address[0]
+		payload[family + "-mask-length"]	= ones
+	}
+}
+
+//
+// PrintGaiaAPI writes the operations as one JSON document; a client posts the requests in order to
+// https://<gateway>/gaia_api/<command>
+//
+func (print *PrintData) PrintGaiaAPI(host string, ops []GaiaOperation) {
+	batch := gaiaBatch{Host: host, Requests: make([]gaiaRequest, 0)}
+
+	for _, op := range ops {
+		batch.Requests = append(batch.Requests, gaiaRequest{op.Command, op.Payload})
+	}
+
+	b, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		fmt.Println("error: " + err.Error())
+		return
+	}
+
+	print.writer.Write(b)
+	print.writer.Write([]byte("\n"))
+}
+
+//
+// PrintAnsible writes a playbook for the host; the inventory must use the httpapi connection
+//
+func (print *PrintData) PrintAnsible(host string, ops []GaiaOperation) {
+	fmt.Fprintf(print.writer, "---\n")
+	fmt.Fprintf(print.writer, "- name: %s\n", yamlString("migrate " + host))
+	fmt.Fprintf(print.writer, "  hosts: %s\n", yamlString(host))
+	fmt.Fprintf(print.writer, "  connection: httpapi\n")
+	fmt.Fprintf(print.writer, "  gather_facts: false\n")
+	fmt.Fprintf(print.writer, "  tasks:\n")
+
+	for _, op := range ops {
+		fmt.Fprintf(print.writer, "    - name: %s\n", yamlString(op.Name))
+		fmt.Fprintf(print.writer, "      check_point.gaia.%s:\n", op.Module)
+
+		writeYaml(print.writer, op.Payload, "        ")
+	}
+}
+
+//
+// writeYaml writes the parameters of a task; it knows just the types GaiaOperations() uses
+//
+func writeYaml(writer io.Writer, params map[string]interface{}, indent string) {
+	var keys []string
+
+	for k := range params {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := strings.Replace(k, "-", "_", -1)
+
+		switch v := params[k].(type) {
+		case []map[string]interface{}:
+			fmt.Fprintf(writer, "%s%s:\n", indent, name)
+
+			for _, m := range v {
+				fmt.Fprintf(writer, "%s  -\n", indent)
+				writeYaml(writer, m, indent + "    ")
+			}
+		case string:
+			fmt.Fprintf(writer, "%s%s: %s\n", indent, name, yamlString(v))
+		default:
+			fmt.Fprintf(writer, "%s%s: %v\n", indent, name, v)
+		}
+	}
+}
+
+//
+// yamlString quotes a string; a JSON string is a valid YAML double quoted scalar
+//
+func yamlString(s string) (quoted string) {
+	b, _ := json.Marshal(s)
+
+	return string(b)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+//
+func TestGaiaOperations(t *testing.T) {
+	tests := []struct {
+		name			string
+		hostData		HostData
+		ops				[]GaiaOperation
+		leftOut			[]ConfigGroup
+	}{
+		{
+			"hostname and DNS",
+			HostData{ClishConfig: "set hostname fw1\nset dns primary 10.0.0.53\nset dns suffix example.com\nset ntp active on"},
+			[]GaiaOperation{
+				{"hostname fw1", "set-hostname", "cp_gaia_hostname", map[string]interface{}{"name": "fw1"}},
+				{"DNS", "set-dns", "cp_gaia_dns", map[string]interface{}{"primary": "10.0.0.53", "suffix": "example.com"}},
+			},
+			[]ConfigGroup{
+				{Name: "NTP", Commands: []string{"set ntp active on"}},
+			},
+		},
+		{
+			"interfaces and bond",
+			HostData{
+				PhysicalInterfaces:	sshtool.PhysicalInterfaces{{IfName: "eth0"}, {IfName: "eth2"}, {IfName: "bond1"}, {IfName: "bond1", VLAN: "100"}},
+				LogicalInterfaces:	sshtool.LogicalInterfaces{
+					{IfName: "eth0", IfIP: "10.0.0.1/24"},
+					{IfName: "eth0", IfIP: "2001:db8::1/64"},
+					{IfName: "bond1", IfIP: "10.10.0.1/24"},
+					{IfName: "bond1.100", IfIP: "192.168.100.1/24"},
+				},
+				ClishConfig:		"add bonding group 1\nadd bonding group 1 interface eth2\nset bonding group 1 mode 8023AD\nset bonding group 1 lacp-rate fast",
+			},
+			[]GaiaOperation{
+				{"interface eth0", "set-physical-interface", "cp_gaia_physical_interface", map[string]interface{}{
+					"name": "eth0", "enabled": true, "ipv4-address": "10.0.0.1", "ipv4-mask-length": 24, "ipv6-address": "2001:db8::1", "ipv6-mask-length": 64,
+				}},
+				{"interface eth2", "set-physical-interface", "cp_gaia_physical_interface", map[string]interface{}{"name": "eth2", "enabled": true}},
+				{"bond bond1", "add-bond-interface", "cp_gaia_bond_interface", map[string]interface{}{
+					"id": 1, "members": []string{"eth2"}, "mode": "8023AD", "ipv4-address": "10.10.0.1", "ipv4-mask-length": 24,
+				}},
+				{"VLAN bond1.100", "add-vlan-interface", "cp_gaia_vlan_interface", map[string]interface{}{
+					"parent": "bond1", "id": 100, "ipv4-address": "192.168.100.1", "ipv4-mask-length": 24,
+				}},
+			},
+			[]ConfigGroup{
+				{Name: "bonds", Commands: []string{"set bonding group 1 lacp-rate fast"}},
+			},
+		},
+		{
+			"static routes",
+			HostData{
+				RouteInfo: []RouteInfo{
+					{Net: "0.0.0.0/0", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "10.0.0.254", Dev: "eth0"}}},
+					{Net: "172.16.0.0/12", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "192.168.100.254", Priority: 1}, {Dev: "eth1"}}},
+					{Net: "10.5.0.0/16", Origin: originStatic, NextHops: []RouteNextHop{{Dev: "eth1"}}},
+					{Net: "10.6.0.0/16", Origin: originStatic, Discard: "blackhole"},
+					{Net: "10.0.0.0/24", Origin: originConnected, NextHops: []RouteNextHop{{Dev: "eth0"}}},
+					{Net: "2001:db8:5::/48", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "2001:db8::fe"}}},
+				},
+			},
+			[]GaiaOperation{
+				{"static route 0.0.0.0/0", "set-static-route", "cp_gaia_static_route", map[string]interface{}{
+					"address": "default", "type": "gateway", "next-hop": []map[string]interface{}{{"gateway": "10.0.0.254"}},
+				}},
+				{"static route 172.16.0.0/12", "set-static-route", "cp_gaia_static_route", map[string]interface{}{
+					"address": "172.16.0.0", "mask-length": 12, "type": "gateway", "next-hop": []map[string]interface{}{{"gateway": "192.168.100.254", "priority": 1}},
+				}},
+				{"static route 10.6.0.0/16", "set-static-route", "cp_gaia_static_route", map[string]interface{}{
+					"address": "10.6.0.0", "mask-length": 16, "type": "blackhole",
+				}},
+			},
+			[]ConfigGroup{
+				{Name: "static routes", Commands: []string{
+					"set static-route 172.16.0.0/12 nexthop gateway logical eth1 on",
+					"set static-route 10.5.0.0/16 nexthop gateway logical eth1 on",
+					"set ipv6 static-route 2001:db8:5::/48 nexthop gateway 2001:db8::fe on",
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if ops := GaiaOperations(test.hostData); !reflect.DeepEqual(ops, test.ops) {
+			t.Errorf("%s:\n got %v\nwant %v", test.name, ops, test.ops)
+		}
+
+		if leftOut := GaiaLeftOut(test.hostData); !reflect.DeepEqual(leftOut, test.leftOut) {
+			t.Errorf("%s: left out\n got %v\nwant %v", test.name, leftOut, test.leftOut)
+		}
+	}
+}
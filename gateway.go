@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+// Gateway is what the commands need from a gateway. PasswordGateway is the live backend of password
+// logins and ClientGateway that of key and agent logins, ReplayGateway serves data captured earlier by
+// 'snapshot' or 'check --format=json'
+//
+type Gateway interface {
+	Connect() error
+	GetOS() (sshtool.OsClass, sshtool.OsType, error)
+	GetInfo() (string, string, error)
+	GetInterfaces() (sshtool.LogicalInterfaces, error)
+	GetPhyInterfaces(sshtool.LogicalInterfaces) (sshtool.PhysicalInterfaces, error)
+	GetRoutes() (sshtool.Routes, error)
+	GetCPHA() (*sshtool.CphaData, error)
+	GetIPv6() (sshtool.LogicalInterfaces, sshtool.Routes, error)
+	GetVAPGroups() (sshtool.VAPGroups, error)
+	ConnectVAP(string, int) error
+	DisconnectVAP()
+	Exit()
+	Disconnect()
+}
+
+type ReplayGateway struct {
+	host					JsonHost
+	errors					uint
+}
+
+var (
+	replayMutex			sync.Mutex
+	replaySnapshots		= make(map[string]map[string]JsonHost)
+
+	errNotCaptured			= errors.New("not in the captured data")
+)
+
+//
+// newGateway returns the backend for a host; a replay when the login names captured data, otherwise SSH
+//
+func newGateway(conn ConnSettings, verbose int) (gateway Gateway, err error) {
+	if conn.Replay != "" {
+		return NewReplayGateway(conn.Replay, conn.Name)
+	}
+
+	if !passwordOnly(conn) {
+		return NewClientGateway(conn), nil
+	}
+
+	action, err := newSshAction(conn, verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordGateway{SshAction: action, conn: conn}, nil
+}
+
+//
+// NewReplayGateway looks up a host in a snapshot directory or json file. A snapshot is only read once
+// however many hosts are replayed from it
+//
+func NewReplayGateway(snapshot string, name string) (gateway *ReplayGateway, err error) {
+	replayMutex.Lock()
+	defer replayMutex.Unlock()
+
+	hosts, ok := replaySnapshots[snapshot]
+	if !ok {
+		if hosts, err = LoadSnapshot(snapshot); err != nil {
+			return nil, err
+		}
+
+		replaySnapshots[snapshot] = hosts
+	}
+
+	host, ok := hosts[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in %s", name, snapshot)
+	}
+
+	gateway = &ReplayGateway{host: host}
+
+	for _, e := range host.Errors {
+		for _, n := range hostErrorNames {
+			if n.name == e {
+				gateway.errors |= n.bit
+			}
+		}
+	}
+
+	return gateway, nil
+}
+
+//
+// the Get functions fail where the host failed when the data was captured
+//
+func (gateway *ReplayGateway) fail(bit uint) (err error) {
+	if (gateway.errors & bit) != 0 {
+		return errNotCaptured
+	}
+
+	return nil
+}
+
+//
+//
+func (gateway *ReplayGateway) Connect() (err error) {
+	if (gateway.errors & errConnect) != 0 {
+		return errors.New(gateway.host.ConnectText)
+	}
+
+	return nil
+}
+
+//
+// GetOS never fails; a capture where it did has no other data to replay anyway
+//
+func (gateway *ReplayGateway) GetOS() (osclass sshtool.OsClass, ostype sshtool.OsType, err error) {
+	osclass	= gateway.host.OsclassID
+	ostype		= gateway.host.OstypeID
+
+	// captures made before the raw values were saved only have the text
+	if gateway.host.Osclass == fmt.Sprintf("%v", sshtool.OsClassXBM) {
+		osclass = sshtool.OsClassXBM
+	}
+
+	return osclass, ostype, nil
+}
+
+//
+//
+func (gateway *ReplayGateway) GetInfo() (fwver string, platform string, err error) {
+	return gateway.host.FwVer, gateway.host.Platform, gateway.fail(errOS)
+}
+
+//
+//
+func (gateway *ReplayGateway) GetInterfaces() (logical sshtool.LogicalInterfaces, err error) {
+	return gateway.host.LogicalInterfaces, gateway.fail(errLogicalInterfaces)
+}
+
+//
+//
+func (gateway *ReplayGateway) GetPhyInterfaces(logical sshtool.LogicalInterfaces) (physical sshtool.PhysicalInterfaces, err error) {
+	return gateway.host.PhysicalInterfaces, gateway.fail(errPhysicalInterfaces)
+}
+
+//
+//
+func (gateway *ReplayGateway) GetRoutes() (routes sshtool.Routes, err error) {
+	return gateway.host.Routes, gateway.fail(errRoutes)
+}
+
+//
+//
+func (gateway *ReplayGateway) GetCPHA() (cpha *sshtool.CphaData, err error) {
+	if err = gateway.fail(errCpha); err == nil && gateway.host.Cpha == nil {
+		err = errNotCaptured
+	}
+
+	return gateway.host.Cpha, err
+}
+
+//
+// GetIPv6 returns nothing more; the replayed interfaces and routes already hold the IPv6 ones
+//
+func (gateway *ReplayGateway) GetIPv6() (logical sshtool.LogicalInterfaces, routes sshtool.Routes, err error) {
+	return nil, nil, gateway.fail(errIPv6)
+}
+
+//
+//
+func (gateway *ReplayGateway) GetVAPGroups() (vapGroups sshtool.VAPGroups, err error) {
+	return vapGroups, errNotCaptured
+}
+
+//
+//
+func (gateway *ReplayGateway) ConnectVAP(name string, index int) (err error) {
+	return errNotCaptured
+}
+
+//
+//
+func (gateway *ReplayGateway) DisconnectVAP() {
+}
+
+//
+//
+func (gateway *ReplayGateway) Exit() {
+}
+
+//
+//
+func (gateway *ReplayGateway) Disconnect() {
+}
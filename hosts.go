@@ -26,14 +26,41 @@
 package main
 
 import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 	"github.com/go-ini/ini"
+	"github.com/mikejac/ssh.golang"
 )
 
 type HostsData struct {
 	cfg	*ini.File
 }
 
+//
+// an ignore rule is a space separated list of conditions which must all match, e.g.
+//
+//   ignore_routes = 10.1.2.0/24, net:169.254.0.0/16, dev:Sync*, gw:10.0.0.1 member:fw1
+//
+// a condition without a prefix matches the route network exactly
+//
+type RouteIgnoreRule struct {
+	Text					string
+	Net					string
+	Within					*net.IPNet
+	Gateway				string
+	Dev					string
+	Member					string
+}
+
+type RouteIgnoreRules []RouteIgnoreRule
+
+const defaultsSection = "defaults"
+
 //
 //
 func NewHosts(hostsFile string) (hosts *HostsData, err error) {
@@ -50,39 +77,199 @@ func NewHosts(hostsFile string) (hosts *HostsData, err error) {
 //
 //
 func (hosts *HostsData) GetHostIP(host string) (ip string) {
-	if hosts.cfg == nil {
-		return host
+	if _, tokens, found := hosts.hostTokens(host); found {
+		if ip, ok := tokens["ip"]; ok {
+			return ip
+		}
 	}
 	
-	names := hosts.cfg.SectionStrings()
-	
-	// let's see if we can find the name
-	for _, n := range names {
-		if hosts.cfg.Section(n).HasKey(host) {
-			val := hosts.cfg.Section(n).Key(host).String()
+	// didn't find the name
+	return host
+}
 
-			//fmt.Printf("HostsData.GetHost(): val = %s\n", val)
-			
-			v := strings.Split(val, ",")
-			
-			//fmt.Printf("HostsData.GetHost(): len = %d\n", len(v))
-			
-			for _, vv := range v {
-				i := strings.Split(vv, ":")
-				
-				//fmt.Printf("HostsData.GetHost(): len = %d, i = %q\n", len(i), i)
-				
-				if len(v) == 1 && len(i) == 1 {							// host=192.168.1.1
-					return i[0]
-				} else if len(i) == 2 && i[0] == "ip" {
-					return i[1]												// host=ip:192.168.1.1
+//
+// GetConnSettings applies the settings of the hosts file to 'login'. A setting on the host itself wins
+// over one in the host's sections, which wins over one in the [defaults] section
+//
+//   [section]
+//   ssh_auth    = key+password
+//   ssh_key     = ~/.ssh/id_rsa
+//   ssh_port    = 2222
+//   ssh_user    = admin
+//   ssh_timeout = 10s
+//   known_hosts = ~/.ckptool/known_hosts
+//   host_key_checking = accept-new
+//   host        = ip:192.168.1.1,port:10022,user:fwadmin,timeout:30,auth:agent
+//
+// The settings are returned along with the error when a password of the host can't be found, so the
+// host can still be reported by its address
+//
+func (hosts *HostsData) GetConnSettings(name string, login Login) (conn ConnSettings, err error) {
+	conn.Login	= login
+	conn.Name	= name
+	conn.Host	= hosts.GetHostIP(name)
+	conn.Auth	= []string{authPassword}
+
+	sections, tokens, _ := hosts.hostTokens(name)
+
+	if val, ok := hosts.hostSetting(sections, tokens, "port", "ssh_port"); ok {
+		if port, err := strconv.Atoi(val); err == nil && port > 0 && port < 65536 {
+			conn.Port = port
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: invalid port '%s'\n", name, val)
+		}
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "user", "ssh_user"); ok {
+		conn.User = val
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "timeout", "ssh_timeout"); ok {
+		if timeout, err := parseTimeout(val); err == nil {
+			conn.Timeout = timeout
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", name, err.Error())
+		}
+	}
+
+	if val, ok := hosts.hostSetting(sections, tokens, "auth", "ssh_auth"); ok {
+		if auth, err := ParseAuth(val); err == nil {
+			conn.Auth = auth
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", name, err.Error())
+		}
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "key", "ssh_key"); ok {
+		conn.KeyFile = val
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "known_hosts", "known_hosts"); ok {
+		conn.KnownHosts = val
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "host_key_checking", "host_key_checking"); ok {
+		if val == hostKeyYes || val == hostKeyAcceptNew || val == hostKeyNo {
+			conn.HostKeyChecking = val
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: invalid host_key_checking '%s'\n", name, val)
+		}
+	}
+
+	// jump hosts log in like the gateway unless told otherwise
+	conn.JumpAuth		= conn.Auth
+	conn.JumpKeyFile	= conn.KeyFile
+	conn.JumpKnownHosts	= conn.KnownHosts
+
+	if val, ok := hosts.hostSetting(sections, tokens, "jump", "ssh_jump"); ok {
+		if jumps, err := ParseJump(val); err == nil {
+			conn.Jump = jumps
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", name, err.Error())
+		}
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "jump_auth", "jump_auth"); ok {
+		if auth, err := ParseAuth(val); err == nil {
+			conn.JumpAuth = auth
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", name, err.Error())
+		}
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "jump_key", "jump_key"); ok {
+		conn.JumpKeyFile = val
+	}
+	if val, ok := hosts.hostSetting(sections, tokens, "jump_known_hosts", "jump_known_hosts"); ok {
+		conn.JumpKnownHosts = val
+	}
+
+	if login.Replay == "" {
+		conn.Password, conn.ExpertPassword, err = login.passwords(name, sections, conn.Auth)
+	}
+
+	return conn, err
+}
+
+//
+// parseTimeout accepts seconds ('30') or a duration ('1m30s')
+//
+func parseTimeout(val string) (timeout time.Duration, err error) {
+	if seconds, err := strconv.Atoi(val); err == nil {
+		timeout = time.Duration(seconds) * time.Second
+	} else if timeout, err = time.ParseDuration(val); err != nil {
+		return 0, fmt.Errorf("invalid timeout '%s'", val)
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout '%s'", val)
+	}
+
+	return timeout, nil
+}
+
+//
+// hostSetting looks up a setting as a token on the host, as a key in the host's sections, in the order
+// of hostTokens(), and as a key in the [defaults] section
+//
+func (hosts *HostsData) hostSetting(sections []string, tokens map[string]string, token string, key string) (val string, ok bool) {
+	if val, ok = tokens[token]; ok {
+		return val, true
+	}
+
+	if hosts == nil || hosts.cfg == nil {
+		return "", false
+	}
+
+	for _, s := range append(append([]string{}, sections...), defaultsSection) {
+		if hosts.cfg.Section(s).HasKey(key) {
+			return hosts.cfg.Section(s).Key(key).String(), true
+		}
+	}
+
+	return "", false
+}
+
+//
+// hostTokens finds a host in the hosts file and splits its value into tokens; a value without any
+// 'name:' prefix is the address of the host. A host may be listed in a cluster section and in inventory
+// sections: all of them are returned, the cluster sections first, and a token of an earlier section wins
+//
+func (hosts *HostsData) hostTokens(host string) (sections []string, tokens map[string]string, found bool) {
+	tokens = make(map[string]string)
+
+	if hosts == nil || hosts.cfg == nil || hosts.reservedKey(host) {
+		return nil, tokens, false
+	}
+
+	var clusters, inventory []string
+
+	for _, n := range hosts.cfg.SectionStrings() {
+		if !hosts.cfg.Section(n).HasKey(host) {
+			continue
+		}
+
+		if strings.HasPrefix(n, "cluster.") {
+			clusters = append(clusters, n)
+		} else {
+			inventory = append(inventory, n)
+		}
+	}
+
+	sections = append(clusters, inventory...)
+
+	for _, n := range sections {
+		val := hosts.cfg.Section(n).Key(host).String()
+
+		v := strings.Split(val, ",")
+
+		for _, vv := range v {
+			i := strings.SplitN(vv, ":", 2)
+
+			if len(v) == 1 && len(i) == 1 {
+				if _, ok := tokens["ip"]; !ok {
+					tokens["ip"] = i[0]									// host=192.168.1.1
 				}
+			} else if _, ok := tokens[i[0]]; !ok && len(i) == 2 {
+				tokens[i[0]] = i[1]										// host=ip:192.168.1.1,auth:key
 			}
 		}
 	}
-	
-	// didn't find the name
-	return host
+
+	return sections, tokens, len(sections) > 0
 }
 
 //
@@ -100,21 +287,146 @@ func (hosts *HostsData) GetClusterMembers(clusterName string) (members []string)
 }
 
 //
+// GetClusterIgnoredRoutes returns the ignore rules of the [defaults] section followed by those of the cluster
 //
-func (hosts *HostsData) GetClusterIgnoredRoutes(clusterName string) (routes map[string]struct{}) {
-	routes = make(map[string]struct{}, 10)
-	
-	if hosts.cfg.Section("cluster." + clusterName).HasKey("ignore_routes") {
-		val := hosts.cfg.Section("cluster." + clusterName).Key("ignore_routes").String()
+func (hosts *HostsData) GetClusterIgnoredRoutes(clusterName string) (rules RouteIgnoreRules) {
+	return hosts.ignoredRoutes("cluster." + clusterName)
+}
+
+//
+// GetXBMIgnoredRoutes returns the ignore rules of the [defaults] section followed by those of the chassis;
+// they apply to all of its VAP groups
+//
+func (hosts *HostsData) GetXBMIgnoredRoutes(chassis string) (rules RouteIgnoreRules) {
+	return hosts.ignoredRoutes("xbm." + chassis)
+}
+
+//
+//
+func (hosts *HostsData) ignoredRoutes(name string) (rules RouteIgnoreRules) {
+	if hosts.cfg == nil {
+		return rules
+	}
+
+	for _, section := range []string{defaultsSection, name} {
+		if hosts.cfg.Section(section).HasKey("ignore_routes") {
+			val := hosts.cfg.Section(section).Key("ignore_routes").String()
 	
-		v := strings.Split(val, ",")
+			v := strings.Split(val, ",")
 		
-		for _, vv := range v {
-			routes[vv] = struct{}{}
+			for _, vv := range v {
+				if rule, err := parseIgnoreRule(strings.TrimSpace(vv)); err == nil {
+					rules = append(rules, rule)
+				} else {
+					fmt.Fprintf(os.Stderr, "WARNING: [%s] ignore_routes: %s\n", section, err.Error())
+				}
+			}
 		}
 	}
 	
-	return routes
+	return rules
+}
+
+//
+//
+func parseIgnoreRule(text string) (rule RouteIgnoreRule, err error) {
+	rule.Text = text
+
+	conditions := strings.Fields(text)
+	if len(conditions) == 0 {
+		return rule, fmt.Errorf("empty rule")
+	}
+
+	for _, c := range conditions {
+		i := strings.SplitN(c, ":", 2)
+
+		if len(i) == 1 {
+			rule.Net = i[0]														// 10.1.2.0/24
+			continue
+		}
+
+		switch i[0] {
+		case "net":																// net:169.254.0.0/16
+			if _, rule.Within, err = net.ParseCIDR(i[1]); err != nil {
+				return rule, fmt.Errorf("invalid network in '%s'", text)
+			}
+		case "gw":																// gw:10.0.0.1
+			rule.Gateway = i[1]
+		case "dev":																// dev:Sync*
+			if _, err = path.Match(i[1], ""); err != nil {
+				return rule, fmt.Errorf("invalid device pattern in '%s'", text)
+			}
+
+			rule.Dev = i[1]
+		case "member":															// member:fw1
+			rule.Member = i[1]
+		default:
+			return rule, fmt.Errorf("unknown condition '%s' in '%s'", i[0], text)
+		}
+	}
+
+	return rule, nil
+}
+
+//
+// Match returns the first rule which ignores route 'r' on cluster member 'member'
+//
+func (rules RouteIgnoreRules) Match(member string, r sshtool.NetworkRoute) (rule string, ignored bool) {
+	for _, ir := range rules {
+		if ir.Net != "" && ir.Net != r.Net {
+			continue
+		}
+		if ir.Within != nil && !(ir.Within.Contains(r.IPNet.IP) && maskLen(r.IPNet.Mask) >= maskLen(ir.Within.Mask)) {
+			continue
+		}
+		if ir.Gateway != "" && ir.Gateway != r.Gateway {
+			continue
+		}
+		if ir.Dev != "" {
+			if ok, _ := path.Match(ir.Dev, r.Dev); !ok {
+				continue
+			}
+		}
+		if ir.Member != "" && ir.Member != member {
+			continue
+		}
+
+		return ir.Text, true
+	}
+
+	return "", false
+}
+
+//
+// MatchAll returns the rule ignoring the route when it is ignored on every one of the members
+//
+func (rules RouteIgnoreRules) MatchAll(members []string, r sshtool.NetworkRoute) (rule string, ignored bool) {
+	for _, m := range members {
+		if rule, ignored = rules.Match(m, r); !ignored {
+			return "", false
+		}
+	}
+
+	return rule, len(members) > 0
+}
+
+//
+//
+func maskLen(mask net.IPMask) (ones int) {
+	ones, _ = mask.Size()
+
+	return ones
+}
+
+//
+// GetDefault returns a key from the [defaults] section
+//
+func (hosts *HostsData) GetDefault(key string) (val string, ok bool) {
+	if hosts == nil || hosts.cfg == nil || !hosts.cfg.Section(defaultsSection).HasKey(key) {
+		return "", false
+	}
+
+	return hosts.cfg.Section(defaultsSection).Key(key).String(), true
 }
 
 //
@@ -123,6 +435,11 @@ func (hosts *HostsData) GetAllHosts() (h []string) {
 	sections := hosts.cfg.SectionStrings()
 	
 	for _, s := range sections {
+		// a CPM is not a gateway
+		if s == defaultsSection || strings.HasPrefix(s, "xbm.") {
+			continue
+		}
+
 		names := hosts.cfg.Section(s).KeyStrings()
 		
 		for _, n := range names {
@@ -141,7 +458,7 @@ func (hosts *HostsData) GetAllStandalone() (h []string) {
 	sections := hosts.cfg.SectionStrings()
 	
 	for _, s := range sections {
-		if !strings.HasPrefix(s, "cluster.") {
+		if !strings.HasPrefix(s, "cluster.") && !strings.HasPrefix(s, "xbm.") && s != defaultsSection {
 			names := hosts.cfg.Section(s).KeyStrings()
 			
 			for _, n := range names {
@@ -168,10 +485,62 @@ func (hosts *HostsData) GetAllCluster() (h []string) {
 
 	return h
 }
+//
+// an XBM chassis is a section holding its CPM like any other host, and optionally the VAP groups to check
+//
+//   [xbm.chassis1]
+//   cpm1       = 10.0.0.50
+//   vap_groups = X02_RTVLPA_DK, X03_RTVLPA_DK
+//
+func (hosts *HostsData) GetAllXBM() (h []string) {
+	sections := hosts.cfg.SectionStrings()
+
+	for _, s := range sections {
+		if strings.HasPrefix(s, "xbm.") {
+			h = append(h, strings.TrimPrefix(s, "xbm."))
+		}
+	}
+
+	return h
+}
+
+//
+//
+func (hosts *HostsData) GetXBMCPM(chassis string) (cpm string) {
+	for _, n := range hosts.cfg.Section("xbm." + chassis).KeyStrings() {
+		if !hosts.reservedKey(n) {
+			return n
+		}
+	}
+
+	return ""
+}
+
+//
+// GetXBMVAPGroups returns the VAP groups of the chassis section; none means all groups of the chassis
+//
+func (hosts *HostsData) GetXBMVAPGroups(chassis string) (groups []string) {
+	section := hosts.cfg.Section("xbm." + chassis)
+
+	if !section.HasKey("vap_groups") {
+		return groups
+	}
+
+	for _, g := range strings.Split(section.Key("vap_groups").String(), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+
+	return groups
+}
+
 //
 //
 func (hosts *HostsData) reservedKey(key string) (yes bool) {
-	if key == "ignore_routes" {
+	switch key {
+	case "ignore_routes", "vap_groups", "ssh_auth", "ssh_key", "ssh_port", "ssh_user", "ssh_timeout",
+		"known_hosts", "host_key_checking", "ssh_jump", "jump_auth", "jump_key", "jump_known_hosts":
 		return true
 	}
 	
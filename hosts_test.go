@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+//
+//
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		text			string
+		err			string
+	}{
+		{"10.1.2.0/24",						""},
+		{"net:169.254.0.0/16 dev:Sync*",		""},
+		{"gw:10.0.0.1 member:fw1",			""},
+		{"",									"empty rule"},
+		{"net:169.254.0.0",					"invalid network in 'net:169.254.0.0'"},
+		{"dev:eth[",							"invalid device pattern in 'dev:eth['"},
+		{"via:10.0.0.1",						"unknown condition 'via' in 'via:10.0.0.1'"},
+	}
+
+	for _, test := range tests {
+		rule, err := parseIgnoreRule(test.text)
+
+		if test.err == "" && err != nil {
+			t.Errorf("'%s': %s", test.text, err.Error())
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("'%s': got error %v, want %s", test.text, err, test.err)
+		} else if err == nil && rule.Text != test.text {
+			t.Errorf("'%s': text is '%s'", test.text, rule.Text)
+		}
+	}
+}
+
+//
+// a route is ignored on a member by the first rule whose conditions all hold, and on a cluster only when
+// it is ignored on every member which has it
+//
+func TestRouteIgnoreRules(t *testing.T) {
+	var rules RouteIgnoreRules
+
+	for _, text := range []string{"10.1.2.0/24", "net:169.254.0.0/16 dev:Sync*", "gw:10.0.0.9", "net:10.8.0.0/16 member:fwa"} {
+		rule, err := parseIgnoreRule(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	tests := []struct {
+		route			string
+		members		[]string
+		rule			string								// empty when not ignored
+	}{
+		{"10.1.2.0/24 10.0.0.1 eth0",			[]string{"fwa", "fwb"},	"10.1.2.0/24"},
+		{"10.1.2.0/25 10.0.0.1 eth0",			[]string{"fwa"},			""},							// only the exact network
+		{"169.254.1.0/24 10.0.0.1 Sync",		[]string{"fwa"},			"net:169.254.0.0/16 dev:Sync*"},
+		{"169.254.0.0/15 10.0.0.1 Sync",		[]string{"fwa"},			""},							// larger than the network
+		{"169.254.1.0/24 10.0.0.1 eth0",		[]string{"fwa"},			""},
+		{"10.5.0.0/16 10.0.0.9 eth0",			[]string{"fwa", "fwb"},	"gw:10.0.0.9"},
+		{"10.8.1.0/24 10.0.0.1 eth0",			[]string{"fwa"},			"net:10.8.0.0/16 member:fwa"},
+		{"10.8.1.0/24 10.0.0.1 eth0",			[]string{"fwa", "fwb"},	""},							// not ignored on fwb
+		{"10.8.1.0/24 10.0.0.1 eth0",			nil,						""},
+	}
+
+	for _, test := range tests {
+		rule, ignored := rules.MatchAll(test.members, testRoutes(t, test.route)[0])
+
+		if rule != test.rule || ignored != (test.rule != "") {
+			t.Errorf("%s on %v: got '%s' %t, want '%s'", test.route, test.members, rule, ignored, test.rule)
+		}
+	}
+}
+
+//
+//
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		val			string
+		timeout		time.Duration
+		ok				bool
+	}{
+		{"30",			30 * time.Second,					true},
+		{"1m30s",		90 * time.Second,					true},
+		{"500ms",		500 * time.Millisecond,			true},
+		{"0",			0,									false},
+		{"-5s",		0,									false},
+		{"30 s",		0,									false},
+		{"soon",		0,									false},
+		{"",			0,									false},
+	}
+
+	for _, test := range tests {
+		timeout, err := parseTimeout(test.val)
+
+		if timeout != test.timeout || (err == nil) != test.ok {
+			t.Errorf("'%s': got %v, %v; want %v, ok %t", test.val, timeout, err, test.timeout, test.ok)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// import reads command output captured on a gateway. A directory holds the files of one host, or one
+// sub directory per host named after the host. Files are recognised by the start of their name:
+//
+//   ifconfig...            ifconfig
+//   netstat...             netstat -rn
+//   cphaprob...            cphaprob state
+//   clish..., show_configuration...
+//                          clish -c "show configuration"
+//   fwver..., fw_ver...    fw ver
+//   ip6addr...             ip -6 -o addr show
+//   ip6route...            ip -6 route show
+//   show_route..., show-route...
+//                          clish -c "show route", optionally followed by clish -c "show ipv6 route"
+//
+// ifconfig and netstat win over the clish configuration, which is used for whatever they don't give.
+// The same goes for the ip -6 files and the IPv6 part of the clish configuration
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+)
+
+var importFiles = []struct {
+	prefix		string
+	kind		string
+}{
+	{"ifconfig",				"ifconfig"},
+	{"netstat",				"netstat"},
+	{"cphaprob",				"cphaprob"},
+	{"clish",					"clish"},
+	{"show_configuration",	"clish"},
+	{"show-configuration",	"clish"},
+	{"fwver",					"fwver"},
+	{"fw_ver",					"fwver"},
+	{"ip6addr",				"ip6addr"},
+	{"ip6route",				"ip6route"},
+	{"show_route",			"showroute"},
+	{"show-route",			"showroute"},
+}
+
+var fwVerRegexp = regexp.MustCompile(`R[0-9]+(\.[0-9]+)*`)
+
+//
+// ImportDirs returns the host directories below 'dir' keyed by host name
+//
+func ImportDirs(dir string) (dirs map[string]string, err error) {
+	dirs = make(map[string]string)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() && importKind(e.Name()) != "" {
+			// the files of a single host
+			abs, _ := filepath.Abs(dir)
+			dirs[filepath.Base(abs)] = dir
+
+			return dirs, nil
+		}
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs[e.Name()] = filepath.Join(dir, e.Name())
+		}
+	}
+
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no command output found in %s", dir)
+	}
+
+	return dirs, nil
+}
+
+//
+// ImportHost builds the HostData of a host from its files with the same error bits checkStandalone()
+// would have set
+//
+func ImportHost(dir string, name string) (hostData HostData, ok bool, err error) {
+	hostData.Name = name
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return hostData, false, err
+	}
+
+	text := make(map[string]string)
+
+	for _, f := range files {
+		kind := importKind(f.Name())
+		if f.IsDir() || kind == "" {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return hostData, false, err
+		}
+
+		text[kind] += string(b)
+	}
+
+	var clish *ClishConfig
+
+	if t, found := text["clish"]; found {
+		clish = ParseClishConfig(t)
+		hostData.ClishConfig = t
+	}
+
+	if t, found := text["ifconfig"]; found {
+		hostData.LogicalInterfaces, hostData.PhysicalInterfaces = parseIfconfig(t)
+	} else if clish != nil {
+		hostData.LogicalInterfaces, hostData.PhysicalInterfaces = clish.Interfaces()
+	}
+
+	if t, found := text["netstat"]; found {
+		hostData.Routes = parseNetstat(t)
+	} else if clish != nil {
+		hostData.Routes = clish.Routes(hostData.LogicalInterfaces)
+	}
+
+	if t, found := text["ip6addr"]; found {
+		hostData.LogicalInterfaces = append(removeIPv6(hostData.LogicalInterfaces), parseIPv6Addr(t)...)
+	} else if clish != nil && !hasIPv6(hostData.LogicalInterfaces) {
+		hostData.LogicalInterfaces = append(hostData.LogicalInterfaces, clish.IPv6Interfaces()...)
+	}
+
+	if t, found := text["ip6route"]; found {
+		hostData.Routes = append(hostData.Routes, parseIPv6Route(t)...)
+	} else if clish != nil {
+		hostData.Routes = append(hostData.Routes, clish.IPv6Routes(hostData.LogicalInterfaces)...)
+	}
+
+	if t, found := text["showroute"]; found {
+		hostData.RouteInfo = parseShowRoute(t)
+	}
+
+	if t, found := text["cphaprob"]; found {
+		hostData.Cpha = parseCphaprob(t)
+	}
+
+	if t, found := text["fwver"]; found {
+		hostData.FwVer = fwVerRegexp.FindString(t)
+	}
+
+	// the live collection gets nothing else without the OS information
+	if hostData.FwVer == "" {
+		hostData.Errors |= errOS
+	}
+	if len(hostData.LogicalInterfaces) == 0 {
+		hostData.Errors |= errLogicalInterfaces
+	}
+	if len(hostData.PhysicalInterfaces) == 0 {
+		hostData.Errors |= errPhysicalInterfaces
+	}
+	if len(hostData.Routes) == 0 {
+		hostData.Errors |= errRoutes
+	}
+	if hostData.Cpha == nil {
+		hostData.Errors |= errCpha
+	}
+
+	return hostData, hostData.Errors == 0, nil
+}
+
+//
+//
+func importKind(file string) (kind string) {
+	file = strings.ToLower(file)
+
+	for _, f := range importFiles {
+		if strings.HasPrefix(file, f.prefix) {
+			return f.kind
+		}
+	}
+
+	return ""
+}
+
+//
+// parseIfconfig reads both the net-tools format
+//
+//   eth1.111  Link encap:Ethernet  HWaddr 00:1C:7F:00:00:01
+//             inet addr:192.168.1.1  Bcast:192.168.1.255  Mask:255.255.255.0
+//
+// and the newer one
+//
+//   eth1.111: flags=4163<UP,BROADCAST,RUNNING,MULTICAST>  mtu 1500
+//           inet 192.168.1.1  netmask 255.255.255.0  broadcast 192.168.1.255
+//
+func parseIfconfig(text string) (logical sshtool.LogicalInterfaces, physical sshtool.PhysicalInterfaces) {
+	var name string
+
+	used := make(map[string]bool)
+
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			name = strings.TrimSuffix(fields[0], ":")
+
+			// loopback and aliases are not configured as interfaces
+			if name == "lo" || strings.Contains(name, ":") {
+				name = ""
+				continue
+			}
+
+			base, vlan := name, ""
+
+			if i := strings.LastIndex(name, "."); i > 0 {
+				base, vlan = name[:i], name[i + 1:]
+			}
+
+			if key := physicalKey(base, vlan); !used[key] {
+				physical = append(physical, sshtool.PhysicalInterface{IfName: base, VLAN: vlan})
+				used[key] = true
+			}
+
+			continue
+		}
+
+		if name != "" && fields[0] == "inet6" && len(fields) >= 3 {
+			if address := ifconfigIPv6(fields); address != "" {
+				logical = append(logical, sshtool.LogicalInterface{IfName: name, IfIP: address})
+			}
+
+			continue
+		}
+
+		if name == "" || fields[0] != "inet" || len(fields) < 2 {
+			continue
+		}
+
+		var ip, mask string
+
+		if strings.HasPrefix(fields[1], "addr:") {
+			ip = strings.TrimPrefix(fields[1], "addr:")
+
+			for _, f := range fields {
+				if strings.HasPrefix(f, "Mask:") {
+					mask = strings.TrimPrefix(f, "Mask:")
+				}
+			}
+		} else {
+			ip = fields[1]
+
+			for i := 2; i + 1 < len(fields); i++ {
+				if fields[i] == "netmask" {
+					mask = fields[i + 1]
+				}
+			}
+		}
+
+		if m := net.ParseIP(mask).To4(); m != nil {
+			ones, _ := net.IPMask(m).Size()
+
+			logical = append(logical, sshtool.LogicalInterface{IfName: name, IfIP: fmt.Sprintf("%s/%d", ip, ones)})
+		}
+	}
+
+	return logical, physical
+}
+
+//
+// ifconfigIPv6 returns the global address of an inet6 line in either format; link local ones are left out
+//
+//   inet6 addr: 2001:db8::1/64 Scope:Global
+//   inet6 2001:db8::1  prefixlen 64  scopeid 0x0<global>
+//
+func ifconfigIPv6(fields []string) (address string) {
+	if fields[1] == "addr:" {
+		if len(fields) >= 4 && fields[3] == "Scope:Global" {
+			return fields[2]
+		}
+
+		return ""
+	}
+
+	for i := 2; i + 1 < len(fields); i++ {
+		if fields[i] == "prefixlen" && strings.Contains(strings.Join(fields, " "), "<global>") {
+			return fields[1] + "/" + fields[i + 1]
+		}
+	}
+
+	return ""
+}
+
+//
+// parseNetstat reads 'netstat -rn'; like sshtool only routes through a gateway are returned
+//
+//   Destination     Gateway         Genmask         Flags   MSS Window  irtt Iface
+//   0.0.0.0         10.0.0.254      0.0.0.0         UG        0 0          0 eth0
+//
+func parseNetstat(text string) (routes sshtool.Routes) {
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 5 || !strings.Contains(fields[3], "G") {
+			continue
+		}
+
+		mask := net.ParseIP(fields[2]).To4()
+		if net.ParseIP(fields[0]) == nil || net.ParseIP(fields[1]) == nil || mask == nil {
+			continue
+		}
+
+		ones, _ := net.IPMask(mask).Size()
+
+		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", fields[0], ones))
+		if err != nil {
+			continue
+		}
+
+		routes = append(routes, sshtool.NetworkRoute{Net: ipNet.String(), Gateway: fields[1], Dev: fields[len(fields) - 1], IPNet: ipNet})
+	}
+
+	return routes
+}
+
+//
+// parseCphaprob returns the state of the local member in lower case, as checkCluster() expects it
+//
+//   Number     Unique Address  Assigned Load   State
+//
+//   1 (local)  10.0.0.1        100%            Active
+//   2          10.0.0.2        0%              Standby
+//
+func parseCphaprob(text string) (cpha *sshtool.CphaData) {
+	var first string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if first == "" {
+			first = line
+		}
+
+		if !strings.Contains(line, "(local)") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		for i := 0; i + 1 < len(fields); i++ {
+			if strings.HasSuffix(fields[i], "%") {
+				return &sshtool.CphaData{Status: strings.ToLower(fields[i + 1])}
+			}
+		}
+	}
+
+	// e.g. 'HA module not started.'; a state table without a local member tells nothing
+	if first == "" || strings.HasPrefix(first, "Cluster Mode") {
+		return nil
+	}
+
+	return &sshtool.CphaData{Status: strings.ToLower(strings.TrimSuffix(first, "."))}
+}
+
+//
+// removeIPv6 drops the IPv6 addresses ifconfig gave, 'ip -6 addr' has them all
+//
+func removeIPv6(logical sshtool.LogicalInterfaces) (ipv4 sshtool.LogicalInterfaces) {
+	for _, i := range logical {
+		if !isIPv6(i.IfIP) {
+			ipv4 = append(ipv4, i)
+		}
+	}
+
+	return ipv4
+}
+
+//
+//
+func hasIPv6(logical sshtool.LogicalInterfaces) (yes bool) {
+	for _, i := range logical {
+		if isIPv6(i.IfIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//
+//
+func sortedDirs(dirs map[string]string) (names []string) {
+	for n := range dirs {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
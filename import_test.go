@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"github.com/mikejac/ssh.golang"
+)
+
+// captured on a Gaia R77.30 gateway (net-tools)
+const ifconfigNetTools = `bond0     Link encap:Ethernet  HWaddr 00:1C:7F:00:00:10
+          inet addr:10.10.0.1  Bcast:10.10.0.255  Mask:255.255.255.0
+          UP BROADCAST RUNNING MASTER MULTICAST  MTU:1500  Metric:1
+
+eth0      Link encap:Ethernet  HWaddr 00:1C:7F:00:00:01
+          inet addr:10.0.0.1  Bcast:10.0.0.255  Mask:255.255.255.0
+          inet6 addr: 2001:db8::1/64 Scope:Global
+          inet6 addr: fe80::21c:7fff:fe00:1/64 Scope:Link
+          UP BROADCAST RUNNING MULTICAST  MTU:1500  Metric:1
+
+eth0:1    Link encap:Ethernet  HWaddr 00:1C:7F:00:00:01
+          inet addr:10.0.0.10  Bcast:10.0.0.255  Mask:255.255.255.0
+
+eth1      Link encap:Ethernet  HWaddr 00:1C:7F:00:00:02
+          UP BROADCAST RUNNING MULTICAST  MTU:1500  Metric:1
+
+eth1.100  Link encap:Ethernet  HWaddr 00:1C:7F:00:00:02
+          inet addr:192.168.100.1  Bcast:192.168.100.255  Mask:255.255.255.0
+
+eth1.200  Link encap:Ethernet  HWaddr 00:1C:7F:00:00:02
+          inet addr:192.168.200.1  Bcast:192.168.200.127  Mask:255.255.255.128
+
+lo        Link encap:Local Loopback
+          inet addr:127.0.0.1  Mask:255.0.0.0
+`
+
+// captured on a Gaia R81.10 gateway
+const ifconfigNew = `eth0: flags=4163<UP,BROADCAST,RUNNING,MULTICAST>  mtu 1500
+        inet 10.0.0.1  netmask 255.255.255.0  broadcast 10.0.0.255
+        inet6 2001:db8::1  prefixlen 64  scopeid 0x0<global>
+        inet6 fe80::21c:7fff:fe00:1  prefixlen 64  scopeid 0x20<link>
+        ether 00:1c:7f:00:00:01  txqueuelen 1000  (Ethernet)
+
+eth1.100: flags=4163<UP,BROADCAST,RUNNING,MULTICAST>  mtu 1500
+        inet 192.168.100.1  netmask 255.255.255.0  broadcast 192.168.100.255
+        ether 00:1c:7f:00:00:02  txqueuelen 1000  (Ethernet)
+
+lo: flags=73<UP,LOOPBACK,RUNNING>  mtu 65536
+        inet 127.0.0.1  netmask 255.0.0.0
+`
+
+const netstatRn = `Kernel IP routing table
+Destination     Gateway         Genmask         Flags   MSS Window  irtt Iface
+0.0.0.0         10.0.0.254      0.0.0.0         UG        0 0          0 eth0
+10.0.0.0        0.0.0.0         255.255.255.0   U         0 0          0 eth0
+172.16.0.0      192.168.100.254 255.240.0.0     UG        0 0          0 eth1.100
+192.168.50.7    10.0.0.253      255.255.255.255 UGH       0 0          0 eth0
+192.168.100.0   0.0.0.0         255.255.255.0   U         0 0          0 eth1.100
+`
+
+//
+// both ifconfig formats; loopback, aliases and link local addresses are left out
+//
+func TestParseIfconfig(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		logical		sshtool.LogicalInterfaces
+		physical		sshtool.PhysicalInterfaces
+	}{
+		{
+			"net-tools", ifconfigNetTools,
+			sshtool.LogicalInterfaces{
+				{IfName: "bond0", IfIP: "10.10.0.1/24"},
+				{IfName: "eth0", IfIP: "10.0.0.1/24"},
+				{IfName: "eth0", IfIP: "2001:db8::1/64"},
+				{IfName: "eth1.100", IfIP: "192.168.100.1/24"},
+				{IfName: "eth1.200", IfIP: "192.168.200.1/25"},
+			},
+			sshtool.PhysicalInterfaces{
+				{IfName: "bond0"},
+				{IfName: "eth0"},
+				{IfName: "eth1"},
+				{IfName: "eth1", VLAN: "100"},
+				{IfName: "eth1", VLAN: "200"},
+			},
+		},
+		{
+			"iproute", ifconfigNew,
+			sshtool.LogicalInterfaces{
+				{IfName: "eth0", IfIP: "10.0.0.1/24"},
+				{IfName: "eth0", IfIP: "2001:db8::1/64"},
+				{IfName: "eth1.100", IfIP: "192.168.100.1/24"},
+			},
+			sshtool.PhysicalInterfaces{
+				{IfName: "eth0"},
+				{IfName: "eth1", VLAN: "100"},
+			},
+		},
+		{
+			"empty", "", nil, nil,
+		},
+	}
+
+	for _, test := range tests {
+		logical, physical := parseIfconfig(test.text)
+
+		if !reflect.DeepEqual(logical, test.logical) {
+			t.Errorf("%s: logical interfaces\n got %v\nwant %v", test.name, logical, test.logical)
+		}
+		if !reflect.DeepEqual(physical, test.physical) {
+			t.Errorf("%s: physical interfaces\n got %v\nwant %v", test.name, physical, test.physical)
+		}
+	}
+}
+
+//
+// only routes through a gateway are returned, as sshtool does
+//
+func TestParseNetstat(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		routes			[]string						// net gateway dev
+	}{
+		{
+			"gateways only", netstatRn,
+			[]string{
+				"0.0.0.0/0 10.0.0.254 eth0",
+				"172.16.0.0/12 192.168.100.254 eth1.100",
+				"192.168.50.7/32 10.0.0.253 eth0",
+			},
+		},
+		{
+			"header only", "Kernel IP routing table\nDestination     Gateway         Genmask         Flags   MSS Window  irtt Iface\n", nil,
+		},
+	}
+
+	for _, test := range tests {
+		var routes []string
+
+		for _, r := range parseNetstat(test.text) {
+			routes = append(routes, r.Net + " " + r.Gateway + " " + r.Dev)
+
+			if r.IPNet == nil || r.IPNet.String() != r.Net {
+				t.Errorf("%s: IPNet of %s is %v", test.name, r.Net, r.IPNet)
+			}
+		}
+
+		if !reflect.DeepEqual(routes, test.routes) {
+			t.Errorf("%s:\n got %v\nwant %v", test.name, routes, test.routes)
+		}
+	}
+}
+
+//
+// a host without 'fw ver' gets the OS error which the live collection would have set
+//
+func TestImportHost(t *testing.T) {
+	tests := []struct {
+		name			string
+		files			map[string]string
+		errors			uint
+	}{
+		{
+			"complete",
+			map[string]string{"ifconfig.txt": ifconfigNetTools, "netstat.txt": netstatRn, "fw_ver.txt": "This is Check Point's software version R80.40 - Build 294\n",
+				"cphaprob.txt": "1 (local)  10.0.0.1        100%            Active\n"},
+			0,
+		},
+		{
+			"no fw ver",
+			map[string]string{"ifconfig.txt": ifconfigNetTools, "netstat.txt": netstatRn, "cphaprob.txt": "1 (local)  10.0.0.1        100%            Active\n"},
+			errOS,
+		},
+		{
+			"fw ver without a version",
+			map[string]string{"ifconfig.txt": ifconfigNetTools, "netstat.txt": netstatRn, "fw_ver.txt": "fw: command not found\n"},
+			errOS | errCpha,
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "ckptool")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for file, text := range test.files {
+			if err = ioutil.WriteFile(filepath.Join(dir, file), []byte(text), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		hostData, ok, err := ImportHost(dir, "fw1")
+		os.RemoveAll(dir)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+		} else if hostData.Errors != test.errors || ok != (test.errors == 0) {
+			t.Errorf("%s: got errors 0x%02x, ok %t; want 0x%02x", test.name, hostData.Errors, ok, test.errors)
+		}
+	}
+}
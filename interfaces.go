@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+)
+
+const (
+	ifMissing				= "missing"				// logical interface not present on all members
+	ifSubnet				= "subnet"					// logical interface in different subnets
+	ifAddress				= "address"				// same host address on more than one member
+	ifPhysical				= "physical"				// physical interface not present on all members
+	ifVLAN					= "vlan"					// VLAN not present on all members
+)
+
+type InterfaceMismatch struct {
+	Interface				string						`json:"interface"`
+	Kind					string						`json:"kind"`
+	Present				[]string					`json:"present"`
+	Missing				[]string					`json:"missing,omitempty"`
+	Values					map[string]string			`json:"values,omitempty"`		// per member address of the interface
+}
+
+//
+// CompareClusterInterfaces checks that all members have the same interfaces, VLANs and subnets. The host
+// part of the addresses is expected to differ between the members
+//
+func CompareClusterInterfaces(members []string, hosts map[string]HostData, verbose int) (mismatches []InterfaceMismatch) {
+	logical  := make(map[string]map[string]string)		// interface[ ipv6] -> member -> ip/len
+	physical := make(map[string]map[string]string)		// interface/vlan -> member -> interface
+
+	for _, m := range members {
+		for _, i := range hosts[m].LogicalInterfaces {
+			key := logicalKey(i)
+
+			if _, ok := logical[key]; !ok {
+				logical[key] = make(map[string]string)
+			}
+
+			logical[key][m] = i.IfIP
+		}
+
+		for _, i := range hosts[m].PhysicalInterfaces {
+			key := physicalKey(i.IfName, i.VLAN)
+
+			if _, ok := physical[key]; !ok {
+				physical[key] = make(map[string]string)
+			}
+
+			physical[key][m] = i.IfName
+		}
+	}
+
+	for _, name := range sortedInterfaceKeys(logical) {
+		present, missing := splitMembers(members, logical[name])
+
+		if len(missing) > 0 {
+			mismatches = append(mismatches, InterfaceMismatch{Interface: name, Kind: ifMissing, Present: present, Missing: missing, Values: logical[name]})
+			continue
+		}
+
+		subnets   := make(map[string]struct{})
+		addresses := make(map[string]struct{})
+		parsed    := 0
+
+		for _, m := range members {
+			ip, ipNet, err := net.ParseCIDR(logical[name][m])
+			if err != nil {
+				// interfaces without an address are only checked for presence
+				continue
+			}
+
+			subnets[ipNet.String()]	= struct{}{}
+			addresses[ip.String()]	= struct{}{}
+			parsed++
+		}
+
+		if len(subnets) > 1 {
+			mismatches = append(mismatches, InterfaceMismatch{Interface: name, Kind: ifSubnet, Present: present, Values: logical[name]})
+		} else if len(subnets) == 1 && len(addresses) < parsed {
+			mismatches = append(mismatches, InterfaceMismatch{Interface: name, Kind: ifAddress, Present: present, Values: logical[name]})
+		}
+	}
+
+	for _, key := range sortedInterfaceKeys(physical) {
+		present, missing := splitMembers(members, physical[key])
+
+		if len(missing) > 0 {
+			kind := ifPhysical
+
+			if physicalKind(key) == "vlan" {
+				kind = ifVLAN
+			}
+
+			mismatches = append(mismatches, InterfaceMismatch{Interface: key, Kind: kind, Present: present, Missing: missing})
+		}
+	}
+
+	if verbose >= 1 {
+		fmt.Fprintf(verboseOut, "CompareClusterInterfaces(): mismatches:\n")
+		fmt.Fprintf(verboseOut, "%q\n", mismatches)
+		fmt.Fprintln(verboseOut)
+	}
+
+	return mismatches
+}
+
+//
+//
+func (mismatch InterfaceMismatch) Description() (text string) {
+	switch mismatch.Kind {
+	case ifMissing:
+		return fmt.Sprintf("interface %s missing on %s", mismatch.Interface, strings.Join(mismatch.Missing, ", "))
+	case ifPhysical:
+		return fmt.Sprintf("physical interface %s missing on %s", mismatch.Interface, strings.Join(mismatch.Missing, ", "))
+	case ifVLAN:
+		return fmt.Sprintf("%s missing on %s", mismatch.Interface, strings.Join(mismatch.Missing, ", "))
+	case ifSubnet:
+		return fmt.Sprintf("interface %s in different subnets: %s", mismatch.Interface, mismatch.valueList())
+	case ifAddress:
+		return fmt.Sprintf("interface %s has the same address on several members: %s", mismatch.Interface, mismatch.valueList())
+	}
+
+	return mismatch.Interface
+}
+
+//
+//
+func (mismatch InterfaceMismatch) valueList() (list string) {
+	var values []string
+
+	for _, m := range mismatch.Present {
+		values = append(values, m + "=" + mismatch.Values[m])
+	}
+
+	return strings.Join(values, ", ")
+}
+
+//
+// logicalKey tells the IPv4 and IPv6 address of an interface apart
+//
+func logicalKey(i sshtool.LogicalInterface) (key string) {
+	if isIPv6(i.IfIP) {
+		return i.IfName + " ipv6"
+	}
+
+	return i.IfName
+}
+
+//
+//
+func splitMembers(members []string, values map[string]string) (present []string, missing []string) {
+	for _, m := range members {
+		if _, ok := values[m]; ok {
+			present = append(present, m)
+		} else {
+			missing = append(missing, m)
+		}
+	}
+
+	return present, missing
+}
+
+//
+//
+func sortedInterfaceKeys(m map[string]map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+//
+func TestCompareClusterInterfaces(t *testing.T) {
+	fwa := HostData{
+		LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.1/24"}, {IfName: "eth1.100", IfIP: "192.168.100.1/24"}},
+		PhysicalInterfaces:	sshtool.PhysicalInterfaces{{IfName: "eth0"}, {IfName: "eth1"}, {IfName: "eth1", VLAN: "100"}},
+	}
+
+	tests := []struct {
+		name			string
+		hosts			map[string]HostData
+		mismatches		[]string
+	}{
+		{
+			"same",
+			map[string]HostData{
+				"fwa": fwa,
+				"fwb": {
+					LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.2/24"}, {IfName: "eth1.100", IfIP: "192.168.100.2/24"}},
+					PhysicalInterfaces:	fwa.PhysicalInterfaces,
+				},
+				"fwc": {
+					LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.3/24"}, {IfName: "eth1.100", IfIP: "192.168.100.3/24"}},
+					PhysicalInterfaces:	fwa.PhysicalInterfaces,
+				},
+			},
+			nil,
+		},
+		{
+			"different",
+			map[string]HostData{
+				"fwa": fwa,
+				"fwb": {
+					LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.1.2/24"}, {IfName: "eth1.100", IfIP: "192.168.100.1/24"}},
+					PhysicalInterfaces:	sshtool.PhysicalInterfaces{{IfName: "eth0"}, {IfName: "eth1"}},
+				},
+				"fwc": {
+					LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.3/24"}, {IfName: "eth2", IfIP: "172.16.0.3/24"}},
+					PhysicalInterfaces:	sshtool.PhysicalInterfaces{{IfName: "eth0"}, {IfName: "eth1"}, {IfName: "eth1", VLAN: "100"}, {IfName: "eth2"}},
+				},
+			},
+			[]string{
+				"interface eth0 in different subnets: fwa=10.0.0.1/24, fwb=10.0.1.2/24, fwc=10.0.0.3/24",
+				"interface eth1.100 missing on fwc",
+				"interface eth2 missing on fwa, fwb",
+				"eth1 vlan 100 missing on fwb",
+				"physical interface eth2 missing on fwa, fwb",
+			},
+		},
+		{
+			"same address",
+			map[string]HostData{
+				"fwa": fwa,
+				"fwb": {
+					LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.2/24"}, {IfName: "eth1.100", IfIP: "192.168.100.1/24"}},
+					PhysicalInterfaces:	fwa.PhysicalInterfaces,
+				},
+				"fwc": {
+					LogicalInterfaces:	sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.3/24"}, {IfName: "eth1.100", IfIP: "192.168.100.3/24"}},
+					PhysicalInterfaces:	fwa.PhysicalInterfaces,
+				},
+			},
+			[]string{
+				"interface eth1.100 has the same address on several members: fwa=192.168.100.1/24, fwb=192.168.100.1/24, fwc=192.168.100.3/24",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var mismatches []string
+
+		for _, m := range CompareClusterInterfaces([]string{"fwa", "fwb", "fwc"}, test.hosts, 0) {
+			mismatches = append(mismatches, m.Description())
+		}
+
+		if !reflect.DeepEqual(mismatches, test.mismatches) {
+			t.Errorf("%s:\n got %q\nwant %q", test.name, mismatches, test.mismatches)
+		}
+	}
+}
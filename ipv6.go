@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// sshtool only collects IPv4. IPv6 addresses and routes are read with 'ip -6' through the Gateway and kept
+// in the same lists as the IPv4 ones, so everything comparing or printing them handles both
+//
+
+package main
+
+import (
+	"net"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+)
+
+const ipv6Separator = "--- ckptool ---"
+
+//
+// collectIPv6 returns the global IPv6 addresses and the IPv6 routes of a gateway, running the commands
+// with 'run' in the session of the gateway. Users whose login shell is clish can't run 'ip', for them the
+// static configuration is used instead. A gateway which has neither has no IPv6; only a failing session
+// is an error
+//
+func collectIPv6(run func(command string) (string, error)) (logical sshtool.LogicalInterfaces, routes sshtool.Routes, err error) {
+	output, err := run("ip -6 -o addr show; echo '" + ipv6Separator + "'; ip -6 route show")
+
+	if strings.Contains(output, ipv6Separator) {
+		parts := strings.SplitN(output, ipv6Separator, 2)
+
+		return parseIPv6Addr(parts[0]), parseIPv6Route(parts[1]), nil
+	}
+
+	if err != nil && !commandFailed(err) {
+		return nil, nil, err
+	}
+
+	for _, command := range []string{"clish -c \"show configuration\"", "show configuration"} {
+		text, err := run(command)
+
+		if err != nil && !commandFailed(err) {
+			return nil, nil, err
+		}
+
+		if err == nil && strings.TrimSpace(text) != "" {
+			config := ParseClishConfig(text)
+			logical = config.IPv6Interfaces()
+
+			return logical, config.IPv6Routes(logical), nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+//
+// parseIPv6Addr reads 'ip -6 -o addr show'; link local addresses are left out
+//
+//   2: eth0    inet6 2001:db8::1/64 scope global \       valid_lft forever preferred_lft forever
+//
+func parseIPv6Addr(text string) (logical sshtool.LogicalInterfaces) {
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 6 || fields[2] != "inet6" || fields[4] != "scope" || fields[5] != "global" {
+			continue
+		}
+
+		name := strings.SplitN(fields[1], "@", 2)[0]
+
+		if _, _, err := net.ParseCIDR(fields[3]); err == nil {
+			logical = append(logical, sshtool.LogicalInterface{IfName: name, IfIP: fields[3]})
+		}
+	}
+
+	return logical
+}
+
+//
+// parseIPv6Route reads 'ip -6 route show'; like for IPv4 only routes through a gateway are returned.
+// Host routes are shown without their prefix length
+//
+//   2001:db8:1::/48 via 2001:db8::fe dev eth0 metric 1024 pref medium
+//   2001:db8:2::5 via 2001:db8::fe dev eth0 metric 1024 pref medium
+//   default via fe80::1 dev eth0 proto static metric 1024
+//
+func parseIPv6Route(text string) (routes sshtool.Routes) {
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) < 3 || fields[1] != "via" {
+			continue
+		}
+
+		dest := fields[0]
+
+		if dest == "default" {
+			dest = "::/0"
+		} else if !strings.Contains(dest, "/") {
+			dest += "/128"
+		}
+
+		_, ipNet, err := net.ParseCIDR(dest)
+		if err != nil {
+			continue
+		}
+
+		r := sshtool.NetworkRoute{Net: ipNet.String(), Gateway: fields[2], IPNet: ipNet}
+
+		for i := 3; i + 1 < len(fields); i++ {
+			if fields[i] == "dev" {
+				r.Dev = fields[i + 1]
+			}
+		}
+
+		routes = append(routes, r)
+	}
+
+	return routes
+}
+
+//
+// IPv6Interfaces returns the IPv6 addresses of the interfaces
+//
+//   set interface eth1 ipv6-address 2001:db8::1 mask-length 64
+//
+func (config *ClishConfig) IPv6Interfaces() (logical sshtool.LogicalInterfaces) {
+	for _, cmd := range config.Find("set", "interface") {
+		if c := cmd.Words; len(c) >= 7 && c[3] == "ipv6-address" && c[5] == "mask-length" {
+			logical = append(logical, sshtool.LogicalInterface{IfName: c[2], IfIP: c[4] + "/" + c[6]})
+		}
+	}
+
+	return logical
+}
+
+//
+// IPv6Routes returns the IPv6 static routes with a gateway
+//
+//   set ipv6 static-route 2001:db8:1::/48 nexthop gateway 2001:db8::fe priority 1 on
+//
+func (config *ClishConfig) IPv6Routes(logical sshtool.LogicalInterfaces) (routes sshtool.Routes) {
+	for _, cmd := range config.Find("set", "ipv6", "static-route") {
+		c := cmd.Words
+
+		if len(c) < 7 || c[4] != "nexthop" || c[5] != "gateway" {
+			continue
+		}
+
+		dest := c[3]
+
+		if dest == "default" {
+			dest = "::/0"
+		} else if !strings.Contains(dest, "/") {
+			dest += "/128"
+		}
+
+		_, ipNet, err := net.ParseCIDR(dest)
+		if err != nil {
+			continue
+		}
+
+		routes = append(routes, sshtool.NetworkRoute{Net: ipNet.String(), Gateway: c[6], Dev: routeDev(c[6], logical), IPNet: ipNet})
+	}
+
+	return routes
+}
+
+//
+// withoutIPv6 returns the host with its IPv4 addresses and routes only, to compare it with hosts where
+// the IPv6 information could not be retrieved
+//
+func withoutIPv6(hostData HostData) (ipv4 HostData) {
+	var routes sshtool.Routes
+
+	for _, r := range hostData.Routes {
+		if !isIPv6(r.Net) {
+			routes = append(routes, r)
+		}
+	}
+
+	hostData.LogicalInterfaces	= removeIPv6(hostData.LogicalInterfaces)
+	hostData.Routes			= routes
+
+	return hostData
+}
+
+//
+//
+func isIPv6(ip string) (yes bool) {
+	return strings.Contains(strings.SplitN(ip, "/", 2)[0], ":")
+}
+
+//
+// sameFamily tells if two routes are both IPv4 or both IPv6
+//
+func sameFamily(r1 sshtool.NetworkRoute, r2 sshtool.NetworkRoute) (same bool) {
+	return (r1.IPNet.IP.To4() == nil) == (r2.IPNet.IP.To4() == nil)
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"golang.org/x/crypto/ssh"
+)
+
+// captured on a Gaia R81.10 gateway
+const ipv6Addr = `1: lo    inet6 ::1/128 scope host \       valid_lft forever preferred_lft forever
+2: eth0    inet6 2001:db8::1/64 scope global \       valid_lft forever preferred_lft forever
+2: eth0    inet6 fe80::21c:7fff:fe00:1/64 scope link \       valid_lft forever preferred_lft forever
+4: eth1.100@eth1    inet6 2001:db8:100::1/64 scope global \       valid_lft forever preferred_lft forever
+`
+
+const ipv6Route = `2001:db8::/64 dev eth0 proto kernel metric 256 pref medium
+2001:db8:5::/48 via 2001:db8::fe dev eth0 metric 1024 pref medium
+2001:db8:6::5 via 2001:db8::fe dev eth0 metric 1024 pref medium
+fe80::/64 dev eth0 proto kernel metric 256 pref medium
+default via fe80::1 dev eth0 proto static metric 1024 pref medium
+`
+
+//
+// global addresses only, with the VLAN named without its parent
+//
+func TestParseIPv6Addr(t *testing.T) {
+	var got []string
+
+	for _, i := range parseIPv6Addr(ipv6Addr) {
+		got = append(got, i.IfName + " " + i.IfIP)
+	}
+
+	if want := []string{"eth0 2001:db8::1/64", "eth1.100 2001:db8:100::1/64"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got %v\nwant %v", got, want)
+	}
+}
+
+//
+// routes through a gateway only, the default route and host routes with their prefix length
+//
+func TestParseIPv6Route(t *testing.T) {
+	var got []string
+
+	for _, r := range parseIPv6Route(ipv6Route) {
+		got = append(got, r.Net + " " + r.Gateway + " " + r.Dev)
+
+		if r.IPNet == nil || r.IPNet.String() != r.Net {
+			t.Errorf("IPNet of %s is %v", r.Net, r.IPNet)
+		}
+	}
+
+	want := []string{"2001:db8:5::/48 2001:db8::fe eth0", "2001:db8:6::5/128 2001:db8::fe eth0", "::/0 fe80::1 eth0"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got %v\nwant %v", got, want)
+	}
+}
+
+//
+// a gateway without 'ip' or without IPv6 has no IPv6; only a failing session is an error
+//
+func TestCollectIPv6(t *testing.T) {
+	type reply struct {
+		output			string
+		err			error
+	}
+
+	ipCommand := "ip -6 -o addr show; echo '" + ipv6Separator + "'; ip -6 route show"
+	lost := errors.New("connection lost")
+
+	tests := []struct {
+		name			string
+		replies		map[string]reply
+		addresses		int
+		routes			int
+		err			error
+	}{
+		{
+			"ip",
+			map[string]reply{ipCommand: {ipv6Addr + ipv6Separator + "\n" + ipv6Route, nil}},
+			2, 3, nil,
+		},
+		{
+			"no ip",
+			map[string]reply{ipCommand: {"\n" + ipv6Separator + "\n", &ssh.ExitError{}}},
+			0, 0, nil,
+		},
+		{
+			"clish shell",
+			map[string]reply{
+				ipCommand:							{"CLINFR0329  Invalid command", &ssh.ExitError{}},
+				"clish -c \"show configuration\"":	{"", &ssh.ExitError{}},
+				"show configuration":				{"set interface eth0 ipv6-address 2001:db8::1 mask-length 64\nset ipv6 static-route 2001:db8:5::/48 nexthop gateway 2001:db8::fe on\n", nil},
+			},
+			1, 1, nil,
+		},
+		{
+			"nothing",
+			map[string]reply{},
+			0, 0, nil,
+		},
+		{
+			"session lost",
+			map[string]reply{ipCommand: {"", lost}},
+			0, 0, lost,
+		},
+	}
+
+	for _, test := range tests {
+		run := func(command string) (output string, err error) {
+			if r, ok := test.replies[command]; ok {
+				return r.output, r.err
+			}
+
+			return "", &ssh.ExitError{}
+		}
+
+		logical, routes, err := collectIPv6(run)
+
+		if len(logical) != test.addresses || len(routes) != test.routes || err != test.err {
+			t.Errorf("%s: got %d addresses, %d routes, %v; want %d, %d, %v", test.name, len(logical), len(routes), err, test.addresses, test.routes, test.err)
+		}
+	}
+}
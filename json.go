@@ -0,0 +1,293 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+// JsonSchemaVersion must be bumped whenever a field is removed or changes meaning
+//
+const JsonSchemaVersion = 1
+
+type JsonDocument struct {
+	SchemaVersion			int							`json:"schema_version"`
+	Command				string						`json:"command"`
+	Hosts					[]JsonHost					`json:"hosts"`
+	Clusters				[]JsonCluster				`json:"clusters"`
+}
+
+type JsonHost struct {
+	Name					string						`json:"name"`
+	Address				string						`json:"address,omitempty"`
+	Ok						bool						`json:"ok"`
+	Errors					[]string					`json:"errors"`
+	ConnectText			string						`json:"connect_text,omitempty"`
+
+	Osclass				string						`json:"os_class"`
+	Ostype					string						`json:"os_type"`
+	OsclassID				sshtool.OsClass			`json:"os_class_id"`		// raw values for the replay backend
+	OstypeID				sshtool.OsType				`json:"os_type_id"`
+	FwVer					string						`json:"fw_ver"`
+	Platform				string						`json:"platform"`
+
+	LogicalInterfaces		sshtool.LogicalInterfaces	`json:"logical_interfaces"`
+	PhysicalInterfaces	sshtool.PhysicalInterfaces	`json:"physical_interfaces"`
+	Routes					sshtool.Routes				`json:"routes"`
+	RouteInfo				[]RouteInfo					`json:"route_info,omitempty"`
+	Cpha					*sshtool.CphaData			`json:"cpha"`
+	ClishConfig			string						`json:"clish_config,omitempty"`
+}
+
+type JsonCluster struct {
+	Name					string						`json:"name"`
+	Ok						bool						`json:"ok"`
+	Errors					[]string					`json:"errors"`
+	Members				[]JsonHost					`json:"members"`
+	MismatchedRoutes		map[string]sshtool.Routes	`json:"mismatched_routes"`
+	Mismatches				[]JsonClusterRoute			`json:"mismatches"`
+	Ignored				[]JsonIgnoredRoute			`json:"ignored"`
+	InterfaceMismatches	[]InterfaceMismatch			`json:"interface_mismatches"`
+	Comparison				*JsonRouteComparison		`json:"comparison,omitempty"`
+}
+
+type JsonRouteComparison struct {
+	SharedRoutes			sshtool.Routes				`json:"shared_routes"`
+	MemberOnlyRoutes		map[string]sshtool.Routes	`json:"member_only_routes"`
+	PartialRoutes			[]JsonClusterRoute			`json:"partial_routes"`
+	IgnoredRoutes			[]string					`json:"ignored_routes"`
+	Ignored				[]JsonIgnoredRoute			`json:"ignored"`
+}
+
+type JsonIgnoredRoute struct {
+	JsonClusterRoute
+	Rule					string						`json:"rule"`
+}
+
+type JsonClusterRoute struct {
+	Route					sshtool.NetworkRoute		`json:"route"`
+	Match					string						`json:"match"`
+	Present				[]string					`json:"present"`
+	Missing				[]string					`json:"missing"`
+}
+
+var hostErrorNames = []struct {
+	bit		uint
+	name	string
+}{
+	{errConnect,				"connect"},
+	{errOS,					"os"},
+	{errLogicalInterfaces,	"logical_interfaces"},
+	{errPhysicalInterfaces,	"physical_interfaces"},
+	{errRoutes,				"routes"},
+	{errCpha,					"cpha"},
+	{errIPv6,					"ipv6"},
+}
+
+var clusterErrorNames = []struct {
+	bit		uint
+	name	string
+}{
+	{errRouteMismatch,		"route_mismatch"},
+	{errCphaStat,				"cpha_status"},
+	{errInterfaceMismatch,	"interface_mismatch"},
+	{errMembers,				"members"},
+}
+
+//
+//
+func NewJsonDocument(command string) (doc *JsonDocument) {
+	doc = &JsonDocument{
+		SchemaVersion:	JsonSchemaVersion,
+		Command:		command,
+		Hosts:			make([]JsonHost, 0),
+		Clusters:		make([]JsonCluster, 0),
+	}
+
+	return doc
+}
+
+//
+//
+func NewJsonHost(hostData HostData, address string, ok bool) (host JsonHost) {
+	host = JsonHost{
+		Name:					hostData.Name,
+		Address:				address,
+		Ok:						ok,
+		Errors:					make([]string, 0),
+		ConnectText:			hostData.ConnectText,
+		Osclass:				fmt.Sprintf("%v", hostData.Osclass),
+		Ostype:					fmt.Sprintf("%v", hostData.Ostype),
+		OsclassID:				hostData.Osclass,
+		OstypeID:				hostData.Ostype,
+		FwVer:					hostData.FwVer,
+		Platform:				hostData.Platform,
+		LogicalInterfaces:		hostData.LogicalInterfaces,
+		PhysicalInterfaces:	hostData.PhysicalInterfaces,
+		Routes:					hostData.Routes,
+		RouteInfo:				hostData.RouteInfo,
+		Cpha:					hostData.Cpha,
+		ClishConfig:			hostData.ClishConfig,
+	}
+
+	for _, e := range hostErrorNames {
+		if (hostData.Errors & e.bit) != 0 {
+			host.Errors = append(host.Errors, e.name)
+		}
+	}
+
+	return host
+}
+
+//
+//
+func NewJsonCluster(clusterData ClusterData, ok bool) (cluster JsonCluster) {
+	cluster = JsonCluster{
+		Name:					clusterData.Name,
+		Ok:						ok,
+		Errors:					make([]string, 0),
+		Members:				make([]JsonHost, 0),
+		MismatchedRoutes:		clusterData.Routes,
+		Mismatches:			make([]JsonClusterRoute, 0),
+		Ignored:				make([]JsonIgnoredRoute, 0),
+		InterfaceMismatches:	clusterData.InterfaceMismatches,
+	}
+
+	if cluster.InterfaceMismatches == nil {
+		cluster.InterfaceMismatches = make([]InterfaceMismatch, 0)
+	}
+
+	for _, ir := range clusterData.Ignored {
+		cluster.Ignored = append(cluster.Ignored, JsonIgnoredRoute{JsonClusterRoute{Route: ir.Route, Match: ir.Match().String(), Present: ir.Present, Missing: ir.Missing}, ir.Rule})
+	}
+
+	for _, cr := range clusterData.Mismatches {
+		cluster.Mismatches = append(cluster.Mismatches, JsonClusterRoute{Route: cr.Route, Match: cr.Match().String(), Present: cr.Present, Missing: cr.Missing})
+	}
+
+	for _, e := range clusterErrorNames {
+		if (clusterData.Errors & e.bit) != 0 {
+			cluster.Errors = append(cluster.Errors, e.name)
+		}
+	}
+
+	for _, m := range clusterData.Members {
+		if h, found := clusterData.Hosts[m]; found {
+			cluster.Members = append(cluster.Members, NewJsonHost(h, "", h.Errors == 0))
+		}
+	}
+
+	return cluster
+}
+
+//
+// NewJsonComparedCluster builds the cluster entry for the 'cluster' command, which compares the hosts
+// directly rather than going through checkCluster()
+//
+func NewJsonComparedCluster(name string, hostData []HostData, hostOk []bool, sharedRoutes sshtool.Routes, partialRoutes []ClusterRoute, ignoredRoutes RouteIgnoreRules) (cluster JsonCluster) {
+	var clusterData ClusterData
+
+	allOk := true
+
+	clusterData.Name		= name
+	clusterData.Hosts		= make(map[string]HostData)
+	clusterData.Routes	= make(map[string]sshtool.Routes)
+
+	for index, h := range hostData {
+		clusterData.Members	= append(clusterData.Members, h.Name)
+		clusterData.Hosts[h.Name]	= h
+
+		if !hostOk[index] {
+			allOk = false
+		}
+	}
+
+	comparison := &JsonRouteComparison{
+		SharedRoutes:		sharedRoutes,
+		MemberOnlyRoutes:	make(map[string]sshtool.Routes),
+		PartialRoutes:		make([]JsonClusterRoute, 0),
+		IgnoredRoutes:		make([]string, 0),
+		Ignored:			make([]JsonIgnoredRoute, 0),
+	}
+
+	for _, cr := range partialRoutes {
+		for _, m := range cr.Present {
+			comparison.MemberOnlyRoutes[m] = append(comparison.MemberOnlyRoutes[m], cr.Route)
+		}
+
+		comparison.PartialRoutes = append(comparison.PartialRoutes, JsonClusterRoute{Route: cr.Route, Match: cr.Match().String(), Present: cr.Present, Missing: cr.Missing})
+
+		if rule, ignored := ignoredRoutes.MatchAll(cr.Present, cr.Route); ignored {
+			comparison.IgnoredRoutes = append(comparison.IgnoredRoutes, cr.Route.Net)
+			comparison.Ignored = append(comparison.Ignored, JsonIgnoredRoute{comparison.PartialRoutes[len(comparison.PartialRoutes) - 1], rule})
+			clusterData.Ignored = append(clusterData.Ignored, IgnoredRoute{cr, rule})
+		} else {
+			clusterData.Mismatches = append(clusterData.Mismatches, cr)
+			clusterData.Errors |= errRouteMismatch
+
+			for _, m := range cr.Present {
+				clusterData.Routes[m] = append(clusterData.Routes[m], cr.Route)
+			}
+		}
+	}
+
+	if allOk {
+		clusterData.InterfaceMismatches = CompareClusterInterfaces(clusterData.Members, clusterData.Hosts, verbose)
+
+		if len(clusterData.InterfaceMismatches) > 0 {
+			clusterData.Errors |= errInterfaceMismatch
+		}
+
+		// as with check, a member which is neither active nor standby fails the cluster
+		for _, m := range clusterData.Members {
+			if !cphaActive(clusterData.Hosts[m].Cpha) {
+				clusterData.Errors |= errCphaStat
+			}
+		}
+	}
+
+	cluster = NewJsonCluster(clusterData, allOk && clusterData.Errors == 0)
+	cluster.Comparison = comparison
+
+	for index := range cluster.Members {
+		cluster.Members[index].Ok = hostOk[index]
+	}
+
+	return cluster
+}
+
+//
+//
+func (print *PrintData) PrintJSON(doc *JsonDocument) (err error) {
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	print.writer.Write(b)
+	print.writer.Write([]byte("\n"))
+
+	return nil
+}
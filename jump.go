@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// jump hosts work like OpenSSH ProxyJump. The connection to the gateway is carried through the chain of
+// jump hosts; sshtool is handed it as a local port on 127.0.0.1, see tunnel(), so it is unaware of it.
+// The host keys of jump hosts are checked against jump_known_hosts, by default the known_hosts of the gateway,
+// as host_key_checking of the gateway says
+//
+//   [defaults]
+//   ssh_jump         = admin@bastion1:2222+bastion2
+//   jump_auth        = agent+password
+//   jump_key         = ~/.ssh/id_bastion
+//   jump_known_hosts = ~/.ssh/known_hosts
+//
+//   [lab]
+//   fw1 = ip:10.1.1.1,jump:none
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"golang.org/x/crypto/ssh"
+)
+
+type JumpHost struct {
+	User					string						// empty means the user of the gateway
+	Host					string
+	Port					int
+}
+
+var (
+	jumpMutex				sync.Mutex
+	jumpClients			= make(map[string]*ssh.Client)
+)
+
+//
+// ParseJump parses a chain of jump hosts like 'admin@bastion1:2222+bastion2'; 'none' is an empty chain
+//
+func ParseJump(val string) (jumps []JumpHost, err error) {
+	if strings.TrimSpace(val) == "none" {
+		return nil, nil
+	}
+
+	for _, j := range strings.Split(val, "+") {
+		var jump JumpHost
+
+		j = strings.TrimSpace(j)
+
+		if i := strings.LastIndex(j, "@"); i >= 0 {
+			jump.User	= j[:i]
+			j			= j[i + 1:]
+		}
+
+		jump.Host = j
+		jump.Port = 22
+
+		if host, port, err := net.SplitHostPort(j); err == nil {
+			jump.Host = host
+
+			if jump.Port, err = strconv.Atoi(port); err != nil || jump.Port < 1 || jump.Port > 65535 {
+				return nil, fmt.Errorf("invalid port in jump host '%s'", j)
+			}
+		}
+
+		if jump.Host == "" {
+			return nil, fmt.Errorf("invalid jump host '%s'", val)
+		}
+
+		jumps = append(jumps, jump)
+	}
+
+	return jumps, nil
+}
+
+//
+//
+func (jump JumpHost) String() (s string) {
+	s = net.JoinHostPort(jump.Host, strconv.Itoa(jump.Port))
+
+	if jump.User != "" {
+		s = jump.User + "@" + s
+	}
+
+	return s
+}
+
+//
+// jumpClient returns the SSH connection to the last jump host. Connections are shared by all gateways
+// behind the same chain of jump hosts
+//
+func jumpClient(conn ConnSettings) (client *ssh.Client, err error) {
+	jumpMutex.Lock()
+	defer jumpMutex.Unlock()
+
+	for index, jump := range conn.Jump {
+		key := jumpChain(conn.Jump[:index + 1])
+
+		if c, ok := jumpClients[key]; ok {
+			client = c
+			continue
+		}
+
+		config, err := jumpConfig(conn, jump)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err = dialSSH(client, net.JoinHostPort(jump.Host, strconv.Itoa(jump.Port)), config)
+
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: %s", jump, err.Error())
+		}
+
+		jumpClients[key] = client
+	}
+
+	return client, nil
+}
+
+//
+//
+func forgetJumpClient(jumps []JumpHost) {
+	jumpMutex.Lock()
+	defer jumpMutex.Unlock()
+
+	for index := range jumps {
+		key := jumpChain(jumps[:index + 1])
+
+		if c, ok := jumpClients[key]; ok {
+			c.Close()
+			delete(jumpClients, key)
+		}
+	}
+}
+
+//
+// jumpConfig builds the client configuration of a jump host from the jump_* settings of the gateway.
+// The password of a jump host is looked up in the vault under the name of the jump host. A jump host
+// whose key is not accepted by the known hosts file is not logged in to
+//
+func jumpConfig(conn ConnSettings, jump JumpHost) (config *ssh.ClientConfig, err error) {
+	jc := conn
+
+	jc.Name		= jump.Host
+	jc.Auth		= conn.JumpAuth
+	jc.KeyFile		= conn.JumpKeyFile
+	jc.Password	= ""
+
+	if memberOf(authPassword, jc.Auth) {
+		var ok bool
+
+		if jc.Password, ok = conn.Login.password(credJump, "Jump Host Password: ", []string{jump.Host}); !ok {
+			return nil, fmt.Errorf("no jump host password available for %s", jump.Host)
+		}
+	}
+
+	methods, err := authMethods(jc)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := hostKeyCallback(conn.JumpKnownHosts, conn.HostKeyChecking)
+	if err != nil {
+		return nil, err
+	}
+
+	config = &ssh.ClientConfig{
+		User:				jump.User,
+		Auth:				methods,
+		HostKeyCallback:	callback,
+		Timeout:			conn.Timeout,
+	}
+
+	if config.User == "" {
+		config.User = conn.User
+	}
+
+	return config, nil
+}
+
+//
+//
+func jumpChain(jumps []JumpHost) (chain string) {
+	var s []string
+
+	for _, j := range jumps {
+		s = append(s, j.String())
+	}
+
+	return strings.Join(s, "+")
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+//
+//
+func TestParseJump(t *testing.T) {
+	tests := []struct {
+		val			string
+		jumps			[]JumpHost
+		err			string
+	}{
+		{"bastion1",						[]JumpHost{{"", "bastion1", 22}},									""},
+		{"admin@bastion1:2222+bastion2",	[]JumpHost{{"admin", "bastion1", 2222}, {"", "bastion2", 22}},	""},
+		{"jump@corp@bastion1",				[]JumpHost{{"jump@corp", "bastion1", 22}},							""},
+		{"[2001:db8::1]:2222",				[]JumpHost{{"", "2001:db8::1", 2222}},								""},
+		{" none ",							nil,																""},
+		{"",								nil,																"invalid jump host ''"},
+		{"bastion1++bastion2",				nil,																"invalid jump host 'bastion1++bastion2'"},
+		{"admin@",							nil,																"invalid jump host 'admin@'"},
+		{"bastion1:ssh",					nil,																"invalid port in jump host 'bastion1:ssh'"},
+		{"bastion1:",						nil,																"invalid port in jump host 'bastion1:'"},
+		{"bastion1:70000",					nil,																"invalid port in jump host 'bastion1:70000'"},
+	}
+
+	for _, test := range tests {
+		jumps, err := ParseJump(test.val)
+
+		if test.err == "" && err != nil {
+			t.Errorf("'%s': %s", test.val, err.Error())
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("'%s': got error %v, want %s", test.val, err, test.err)
+		} else if !reflect.DeepEqual(jumps, test.jumps) {
+			t.Errorf("'%s':\n got %v\nwant %v", test.val, jumps, test.jumps)
+		}
+	}
+}
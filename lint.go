@@ -0,0 +1,405 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// a checker for clish scripts. Every line must match one of the commands below, which are those migrate
+// writes; the arguments of commands copied as is from the configuration are not checked. The script is
+// then walked in order the way Gaia would apply it: interfaces must exist before they are used, route next
+// hops must be in a subnet configured further up and no address may be used twice
+//
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var clishGrammar = []string{
+	"set hostname <word>",
+	"set dns <word> <word>",
+	"set ntp <rest>",
+	"add ntp <rest>",
+	"set interface <if> state on|off",
+	"set interface <if> ipv4-address <ip4> mask-length <len4>",
+	"set interface <if> ipv6-address <ip6> mask-length <len6>",
+	"set interface <if> mtu <n>",
+	"set interface <if> comments <rest>",
+	"add interface <if> vlan <vlan>",
+	"add interface <if> alias <cidr4>",
+	"add bonding group <n>",
+	"add bonding group <n> interface <if>",
+	"set bonding group <n> <rest>",
+	"set static-route <net4> nexthop gateway address <ip4> on|off",
+	"set static-route <net4> nexthop gateway address <ip4> priority <prio> on|off",
+	"set static-route <net4> nexthop gateway logical <if> on|off",
+	"set static-route <net4> nexthop gateway logical <if> priority <prio> on|off",
+	"set static-route <net4> nexthop blackhole|reject",
+	"set ipv6 static-route <net6> nexthop gateway <ip6> on|off",
+	"set ipv6 static-route <net6> nexthop gateway <ip6> priority <prio> on|off",
+	"set ipv6 static-route <net6> nexthop gateway logical <if> on|off",
+	"set ipv6 static-route <net6> nexthop gateway logical <if> priority <prio> on|off",
+	"set ipv6 static-route <net6> nexthop blackhole|reject",
+	"add arp proxy <rest>",
+	"set bootp <rest>",
+	"set dhcp-relay <rest>",
+	"set syslog <rest>",
+	"add syslog <rest>",
+	"set snmp <rest>",
+	"add snmp <rest>",
+}
+
+var clishInterfaceRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*(\.[0-9]+)?$`)
+
+type LintProblem struct {
+	Line					int
+	Text					string
+	Message				string
+}
+
+type clishLinter struct {
+	interfaces				map[string]bool				// interfaces which exist at this point of the script
+	addresses				map[string]int				// address -> line
+	primary				map[string]int				// interface and address family -> line
+	subnets				[]*net.IPNet
+	problems				[]LintProblem
+}
+
+//
+//
+func (problem LintProblem) String() string {
+	return fmt.Sprintf("line %d: %s: %s", problem.Line, problem.Message, problem.Text)
+}
+
+//
+// LintClish checks a clish script and returns the problems found in the order of the lines
+//
+func LintClish(text string) (problems []LintProblem) {
+	linter := clishLinter{
+		interfaces:	make(map[string]bool),
+		addresses:	make(map[string]int),
+		primary:	make(map[string]int),
+	}
+
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			// migrate leaves these where it could not write a command
+			if strings.HasPrefix(line, "# invalid") {
+				linter.problem(n + 1, line, strings.TrimPrefix(line, "# "))
+			}
+
+			continue
+		}
+
+		if message := matchClish(strings.Fields(line)); message != "" {
+			linter.problem(n + 1, line, message)
+			continue
+		}
+
+		linter.check(n + 1, line, strings.Fields(line))
+	}
+
+	return linter.problems
+}
+
+//
+// matchClish returns why the words are not a known command, or "" if they are. The pattern which
+// matched the most words tells what was expected
+//
+func matchClish(words []string) (message string) {
+	best := -1
+
+	for _, pattern := range clishGrammar {
+		tokens := strings.Fields(pattern)
+
+		matched, expected := matchTokens(words, tokens)
+		if matched == len(words) && expected == "" {
+			return ""
+		}
+
+		// nothing but the command verb in common is not worth a hint
+		if matched > best && matched > 1 {
+			best = matched
+
+			if matched < len(words) && expected != "" {
+				message = fmt.Sprintf("expected %s at '%s'", expected, words[matched])
+			} else if expected != "" {
+				message = fmt.Sprintf("expected %s after '%s'", expected, words[matched - 1])
+			} else {
+				message = fmt.Sprintf("unexpected '%s'", words[matched])
+			}
+		}
+	}
+
+	if message == "" {
+		message = "unknown command"
+	}
+
+	return message
+}
+
+//
+// matchTokens returns how many words match the tokens and the token which did not match, if any
+//
+func matchTokens(words []string, tokens []string) (matched int, expected string) {
+	for i, token := range tokens {
+		if token == "<rest>" {
+			if i < len(words) {
+				return len(words), ""
+			}
+
+			return i, "more words"
+		}
+
+		if i >= len(words) {
+			return i, clishTokenName(token)
+		}
+
+		if !matchToken(words[i], token) {
+			return i, clishTokenName(token)
+		}
+	}
+
+	return len(tokens), ""
+}
+
+//
+//
+func matchToken(word string, token string) (ok bool) {
+	switch token {
+	case "<word>":
+		return true
+	case "<if>":
+		return clishInterfaceRegexp.MatchString(word)
+	case "<ip4>":
+		ip := net.ParseIP(word)
+		return ip != nil && ip.To4() != nil
+	case "<ip6>":
+		ip := net.ParseIP(word)
+		return ip != nil && ip.To4() == nil
+	case "<len4>":
+		return numberIn(word, 0, 32)
+	case "<len6>":
+		return numberIn(word, 0, 128)
+	case "<n>":
+		return numberIn(word, 0, 1 << 30)
+	case "<vlan>":
+		return numberIn(word, 2, 4094)
+	case "<prio>":
+		return numberIn(word, 1, 8)
+	case "<cidr4>", "<net4>":
+		ip, _, err := net.ParseCIDR(word)
+		return (token == "<net4>" && word == "default") || (err == nil && ip.To4() != nil)
+	case "<net6>":
+		ip, _, err := net.ParseCIDR(word)
+		return word == "default" || (err == nil && ip.To4() == nil)
+	}
+
+	for _, alternative := range strings.Split(token, "|") {
+		if word == alternative {
+			return true
+		}
+	}
+
+	return false
+}
+
+//
+//
+func clishTokenName(token string) (name string) {
+	switch token {
+	case "<word>":
+		return "a value"
+	case "<if>":
+		return "an interface name"
+	case "<ip4>":
+		return "an IPv4 address"
+	case "<ip6>":
+		return "an IPv6 address"
+	case "<len4>":
+		return "a mask length of 0-32"
+	case "<len6>":
+		return "a mask length of 0-128"
+	case "<n>":
+		return "a number"
+	case "<vlan>":
+		return "a VLAN id of 2-4094"
+	case "<prio>":
+		return "a priority of 1-8"
+	case "<cidr4>":
+		return "an IPv4 address/mask length"
+	case "<net4>":
+		return "'default' or an IPv4 network"
+	case "<net6>":
+		return "'default' or an IPv6 network"
+	}
+
+	return "'" + strings.Replace(token, "|", "' or '", -1) + "'"
+}
+
+//
+//
+func numberIn(word string, min int, max int) (ok bool) {
+	n, err := strconv.Atoi(word)
+
+	return err == nil && n >= min && n <= max
+}
+
+//
+// check applies a command which matched the grammar to what exists so far
+//
+func (linter *clishLinter) check(n int, line string, w []string) {
+	switch {
+	case w[0] == "add" && w[1] == "bonding" && len(w) == 4:
+		linter.interfaces["bond" + w[3]] = true
+
+	case w[1] == "bonding":
+		linter.exists(n, line, "bond" + w[3])
+
+		if w[0] == "add" {
+			linter.exists(n, line, w[5])
+		}
+
+	case w[0] == "add" && w[1] == "interface" && w[3] == "vlan":
+		vlan := w[2] + "." + w[4]
+
+		if !linter.interfaces[w[2]] {
+			linter.problem(n, line, "VLAN parent " + w[2] + " is not configured before the VLAN")
+		}
+		if linter.interfaces[vlan] {
+			linter.problem(n, line, "VLAN " + vlan + " is added twice")
+		}
+
+		linter.interfaces[vlan] = true
+
+	case w[0] == "set" && w[1] == "interface" && w[3] == "state" && linter.physical(w[2]):
+		// a physical interface exists on the target as soon as it is mentioned
+
+	case w[1] == "interface":
+		linter.exists(n, line, w[2])
+
+		if w[3] == "ipv4-address" || w[3] == "ipv6-address" {
+			linter.address(n, line, w[2], w[3], w[4], w[6])
+		} else if w[3] == "alias" {
+			p := strings.Split(w[4], "/")
+			linter.address(n, line, w[2], w[3], p[0], p[1])
+		}
+
+	case w[1] == "static-route" && w[4] == "gateway" && w[5] == "address":
+		linter.nextHop(n, line, w[6])
+
+	case w[1] == "static-route" && w[4] == "gateway" && w[5] == "logical":
+		linter.exists(n, line, w[6])
+
+	case w[1] == "ipv6" && w[2] == "static-route" && w[5] == "gateway" && w[6] == "logical":
+		linter.exists(n, line, w[7])
+
+	case w[1] == "ipv6" && w[2] == "static-route" && w[5] == "gateway":
+		linter.nextHop(n, line, w[6])
+	}
+}
+
+//
+// physical tells if an interface is neither a VLAN nor a bond, and marks it as existing
+//
+func (linter *clishLinter) physical(name string) (yes bool) {
+	if strings.Contains(name, ".") || strings.HasPrefix(name, "bond") {
+		return false
+	}
+
+	linter.interfaces[name] = true
+
+	return true
+}
+
+//
+//
+func (linter *clishLinter) exists(n int, line string, name string) {
+	if linter.physical(name) || linter.interfaces[name] {
+		return
+	}
+
+	if strings.Contains(name, ".") {
+		linter.problem(n, line, "VLAN " + name + " is not added before it is used")
+	} else {
+		linter.problem(n, line, "bond " + name + " is not added before it is used")
+	}
+}
+
+//
+//
+func (linter *clishLinter) address(n int, line string, name string, kind string, ip string, length string) {
+	_, ipNet, _ := net.ParseCIDR(ip + "/" + length)
+	addr := net.ParseIP(ip).String()
+
+	if first, found := linter.addresses[addr]; found {
+		linter.problem(n, line, fmt.Sprintf("address %s is already used on line %d", addr, first))
+	} else {
+		linter.addresses[addr] = n
+	}
+
+	if kind != "alias" {
+		if first, found := linter.primary[name + " " + kind]; found {
+			linter.problem(n, line, fmt.Sprintf("%s already has an %s on line %d", name, kind, first))
+		} else {
+			linter.primary[name + " " + kind] = n
+		}
+	}
+
+	if ipNet != nil {
+		linter.subnets = append(linter.subnets, ipNet)
+	}
+}
+
+//
+// nextHop checks that a gateway can be reached through an address configured further up. IPv6 link local
+// gateways are reachable through any interface
+//
+func (linter *clishLinter) nextHop(n int, line string, gateway string) {
+	ip := net.ParseIP(gateway)
+
+	if ip.IsLinkLocalUnicast() {
+		return
+	}
+
+	for _, subnet := range linter.subnets {
+		if subnet.Contains(ip) {
+			return
+		}
+	}
+
+	linter.problem(n, line, "next hop " + gateway + " is not in a subnet configured before the route")
+}
+
+//
+//
+func (linter *clishLinter) problem(n int, line string, message string) {
+	linter.problems = append(linter.problems, LintProblem{Line: n, Text: line, Message: message})
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// written by migrate for a gateway with a bond, VLANs and static routes
+const lintScript = `set hostname fw1
+set interface eth0 state on
+set interface eth0 ipv4-address 10.0.0.1 mask-length 24
+set interface eth0 ipv6-address 2001:db8::1 mask-length 64
+set interface eth1 state on
+add interface eth1 vlan 100
+set interface eth1.100 ipv4-address 192.168.100.1 mask-length 24
+add interface eth1.100 alias 192.168.100.10/24
+add bonding group 1
+add bonding group 1 interface eth2
+set interface bond1 ipv4-address 10.10.0.1 mask-length 24
+set static-route default nexthop gateway address 10.0.0.254 on
+set static-route 172.16.0.0/12 nexthop gateway address 192.168.100.254 priority 1 on
+set static-route 10.5.0.0/16 nexthop gateway logical eth1.100 on
+set ipv6 static-route default nexthop gateway fe80::1 on
+set ipv6 static-route 2001:db8:5::/48 nexthop gateway 2001:db8::fe on
+set snmp community public read-only`
+
+//
+//
+func TestLintClish(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		problems		[]string
+	}{
+		{
+			"clean", lintScript, nil,
+		},
+		{
+			"grammar",
+			`show version
+set interface eth0 ipv4-address 10.0.0.1 mask-length 33
+add interface eth1 vlan 4095
+set static-route 10.5.0.0/16 nexthop gateway address 10.0.0.254 priority 9 on
+# invalid next hop for 10.6.0.0/16`,
+			[]string{
+				"line 1: unknown command: show version",
+				"line 2: expected a mask length of 0-32 at '33': set interface eth0 ipv4-address 10.0.0.1 mask-length 33",
+				"line 3: expected a VLAN id of 2-4094 at '4095': add interface eth1 vlan 4095",
+				"line 4: expected a priority of 1-8 at '9': set static-route 10.5.0.0/16 nexthop gateway address 10.0.0.254 priority 9 on",
+				"line 5: invalid next hop for 10.6.0.0/16: # invalid next hop for 10.6.0.0/16",
+			},
+		},
+		{
+			"order",
+			`add interface eth1 vlan 100
+set interface eth1.200 ipv4-address 10.2.0.1 mask-length 24
+add bonding group 1 interface eth2
+set static-route 10.9.0.0/16 nexthop gateway address 172.16.0.1 on
+set interface eth0 ipv4-address 10.0.0.1 mask-length 24
+add interface eth0 alias 10.0.0.1/24
+set interface eth0 ipv4-address 10.0.0.2 mask-length 24
+add interface eth1 vlan 100`,
+			[]string{
+				"line 1: VLAN parent eth1 is not configured before the VLAN: add interface eth1 vlan 100",
+				"line 2: VLAN eth1.200 is not added before it is used: set interface eth1.200 ipv4-address 10.2.0.1 mask-length 24",
+				"line 3: bond bond1 is not added before it is used: add bonding group 1 interface eth2",
+				"line 4: next hop 172.16.0.1 is not in a subnet configured before the route: set static-route 10.9.0.0/16 nexthop gateway address 172.16.0.1 on",
+				"line 6: address 10.0.0.1 is already used on line 5: add interface eth0 alias 10.0.0.1/24",
+				"line 7: eth0 already has an ipv4-address on line 5: set interface eth0 ipv4-address 10.0.0.2 mask-length 24",
+				"line 8: VLAN parent eth1 is not configured before the VLAN: add interface eth1 vlan 100",
+				"line 8: VLAN eth1.100 is added twice: add interface eth1 vlan 100",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var problems []string
+
+		for _, p := range LintClish(test.text) {
+			problems = append(problems, p.String())
+		}
+
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s:\n got %q\nwant %q", test.name, problems, test.problems)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// an interface map renames the interfaces of the source gateway to those of the target, e.g.
+//
+//   eth1  = eth1-01
+//   eth2  = eth1-02
+//   bond0 = bond1
+//
+// VLAN interfaces follow their physical interface, eth1.111 becomes eth1-01.111. The target may itself
+// be a VLAN interface, which is how the circuits of a CrossBeam VAP are mapped
+//
+//   ext_ckt = eth1-01.120
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"github.com/go-ini/ini"
+	"github.com/mikejac/ssh.golang"
+)
+
+type InterfaceMap struct {
+	names					map[string]string
+	used					map[string]bool
+}
+
+//
+//
+func LoadInterfaceMap(file string) (imap *InterfaceMap, err error) {
+	cfg, err := ini.Load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	imap = &InterfaceMap{
+		names:	make(map[string]string),
+		used:	make(map[string]bool),
+	}
+
+	sources := make(map[string]string)						// target -> source
+
+	for _, key := range cfg.Section("").Keys() {
+		if strings.Contains(key.Name(), ".") {
+			return nil, fmt.Errorf("%s: map physical interfaces, not VLAN interfaces ('%s')", file, key.Name())
+		}
+
+		target := strings.TrimSpace(key.String())
+
+		if source, found := sources[target]; found {
+			return nil, fmt.Errorf("%s: %s and %s are both mapped to %s", file, source, key.Name(), target)
+		}
+
+		sources[target] = key.Name()
+		imap.names[key.Name()] = target
+	}
+
+	return imap, nil
+}
+
+//
+// Rename returns the target name of an interface or VLAN interface
+//
+func (imap *InterfaceMap) Rename(name string) (target string, ok bool) {
+	base, vlan := name, ""
+
+	if i := strings.Index(name, "."); i > 0 {
+		base, vlan = name[:i], name[i:]
+	}
+
+	if target, ok = imap.names[base]; !ok {
+		return name, false
+	}
+
+	imap.used[base] = true
+
+	return target + vlan, true
+}
+
+//
+// Apply renames the interfaces everywhere in the data of a host. Every interface of the host must be
+// in the map; all that are missing are reported at once
+//
+func (imap *InterfaceMap) Apply(hostData HostData) (mapped HostData, err error) {
+	var missing []string
+
+	rename := func(name string) (target string) {
+		target, ok := imap.Rename(name)
+		if !ok {
+			missing = appendUnique(missing, strings.SplitN(name, ".", 2)[0])
+		}
+
+		return target
+	}
+
+	mapped = hostData
+
+	mapped.PhysicalInterfaces = nil
+	for _, i := range hostData.PhysicalInterfaces {
+		i.IfName = rename(i.IfName)
+
+		// an interface mapped to a VLAN interface becomes that VLAN
+		if n := strings.LastIndex(i.IfName, "."); i.VLAN == "" && n > 0 {
+			i.IfName, i.VLAN = i.IfName[:n], i.IfName[n + 1:]
+		}
+
+		mapped.PhysicalInterfaces = append(mapped.PhysicalInterfaces, i)
+	}
+
+	// e.g. eth1 = eth1-01 and ckt = eth1-01.120 when eth1 has VLAN 120
+	if err = samePhysicalInterfaces(hostData.PhysicalInterfaces, mapped.PhysicalInterfaces); err != nil {
+		return hostData, err
+	}
+
+	mapped.LogicalInterfaces = nil
+	for _, i := range hostData.LogicalInterfaces {
+		i.IfName = rename(i.IfName)
+		mapped.LogicalInterfaces = append(mapped.LogicalInterfaces, i)
+	}
+
+	mapped.Routes = nil
+	for _, r := range hostData.Routes {
+		if r.Dev != "" {
+			r.Dev = rename(r.Dev)
+		}
+		mapped.Routes = append(mapped.Routes, r)
+	}
+
+	mapped.RouteInfo = nil
+	for _, r := range hostData.RouteInfo {
+		var nextHops []RouteNextHop
+
+		for _, h := range r.NextHops {
+			if h.Dev != "" {
+				h.Dev = rename(h.Dev)
+			}
+			nextHops = append(nextHops, h)
+		}
+
+		r.NextHops = nextHops
+		mapped.RouteInfo = append(mapped.RouteInfo, r)
+	}
+
+	if hostData.ClishConfig != "" {
+		mapped.ClishConfig = imap.applyClish(hostData.ClishConfig, rename)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		return hostData, fmt.Errorf("no mapping for interface(s) %s", strings.Join(missing, ", "))
+	}
+
+	return mapped, nil
+}
+
+//
+// applyClish renames the interfaces in the commands of 'show configuration'. Only the words where the
+// commands name an interface are renamed, never host names, comments or the like. Bond groups are renamed
+// through their bond interface, 'add bonding group 0' becomes 'add bonding group 1' with bond0 = bond1
+//
+func (imap *InterfaceMap) applyClish(text string, rename func(string) string) (mapped string) {
+	var lines []string
+
+	for _, line := range strings.Split(text, "\n") {
+		words := strings.Split(line, " ")
+		fields := strings.Fields(line)
+
+		for _, i := range clishInterfaceWords(words) {
+			words[i] = rename(words[i])
+		}
+
+		// the group number is the fourth word; the separators are single spaces in clish output
+		if len(fields) > 3 && fields[1] == "bonding" && fields[2] == "group" {
+			if target := rename("bond" + fields[3]); strings.HasPrefix(target, "bond") {
+				for i, w := range words {
+					if w == fields[3] && i > 0 && words[i - 1] == "group" {
+						words[i] = strings.TrimPrefix(target, "bond")
+						break
+					}
+				}
+			}
+		}
+
+		lines = append(lines, strings.Join(words, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+//
+// clishInterfaceWords returns the indexes of the words which name an interface in a clish command
+//
+//   set|add|delete interface <if> ...
+//   add bonding group <n> interface <if>
+//   set [ipv6] static-route <net> nexthop gateway logical <if> ...
+//   set ipv6 static-route <net> nexthop gateway <gw> interface <if> ...
+//   add arp proxy ipv4-address <ip> interface <if> ...
+//   set bootp|dhcp-relay interface <if> ...
+//
+func clishInterfaceWords(words []string) (indexes []int) {
+	var fields []int												// the indexes of the words which are not empty
+
+	for i, w := range words {
+		if w != "" {
+			fields = append(fields, i)
+		}
+	}
+
+	if len(fields) < 3 {
+		return nil
+	}
+
+	word := func(n int) string {
+		return words[fields[n]]
+	}
+
+	switch {
+	case word(1) == "interface":
+		if (word(0) == "set" || word(0) == "add" || word(0) == "delete") && word(2) != "lo" {
+			indexes = append(indexes, fields[2])
+		}
+	case word(1) == "bonding" && word(2) == "group",
+		word(1) == "static-route", word(1) == "ipv6" && word(2) == "static-route",
+		word(1) == "arp", word(1) == "bootp", word(1) == "dhcp-relay":
+		for n := 2; n + 1 < len(fields); n++ {
+			if word(n) == "interface" || word(n) == "logical" {
+				indexes = append(indexes, fields[n + 1])
+				n++
+			}
+		}
+	}
+
+	return indexes
+}
+
+//
+// samePhysicalInterfaces fails when the map turned different interfaces into the same one
+//
+func samePhysicalInterfaces(source sshtool.PhysicalInterfaces, mapped sshtool.PhysicalInterfaces) (err error) {
+	seen := make(map[string]string)
+
+	dotted := func(i sshtool.PhysicalInterface) string {
+		if i.VLAN == "" {
+			return i.IfName
+		}
+
+		return i.IfName + "." + i.VLAN
+	}
+
+	for index, i := range mapped {
+		key := dotted(i)
+		name := dotted(source[index])
+
+		if first, found := seen[key]; found && first != name {
+			return fmt.Errorf("%s and %s are both mapped to %s", first, name, key)
+		}
+
+		seen[key] = name
+	}
+
+	return nil
+}
+
+//
+// Unused returns the mappings which were not needed by the host
+//
+func (imap *InterfaceMap) Unused() (unused []string) {
+	for name, target := range imap.names {
+		if !imap.used[name] {
+			unused = append(unused, name + " = " + target)
+		}
+	}
+
+	sort.Strings(unused)
+
+	return unused
+}
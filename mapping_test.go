@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+// loadTestMap writes the map file and loads it
+//
+func loadTestMap(t *testing.T, text string) (imap *InterfaceMap, err error) {
+	f, err := ioutil.TempFile("", "ckptool-map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	return LoadInterfaceMap(f.Name())
+}
+
+//
+//
+func TestLoadInterfaceMap(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		err			string						// part of the error, "" for none
+	}{
+		{"ok",				"eth0 = eth1-01\neth1 = eth1-02\n",		""},
+		{"vlan source",	"eth1.100 = eth1-02.100\n",				"not VLAN interfaces"},
+		{"same target",	"eth0 = eth1-01\neth1 = eth1-01\n",		"eth0 and eth1 are both mapped to eth1-01"},
+	}
+
+	for _, test := range tests {
+		_, err := loadTestMap(t, test.text)
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err.Error())
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want one with '%s'", test.name, err, test.err)
+		}
+	}
+}
+
+// part of 'show configuration' of the source gateway
+const mappingClish = `set hostname eth0
+set interface eth0 comments "eth0 uplink"
+set interface eth0 ipv4-address 10.0.0.1 mask-length 24
+add interface eth1 vlan 100
+set interface eth1.100 ipv4-address 192.168.100.1 mask-length 24
+add bonding group 0
+add bonding group 0 interface eth2
+set static-route 10.5.0.0/16 nexthop gateway logical eth1.100 on
+set snmp community eth1 read-only
+set interface lo ipv4-address 127.0.0.1 mask-length 8`
+
+//
+//
+func TestInterfaceMapApply(t *testing.T) {
+	hostData := HostData{
+		PhysicalInterfaces: sshtool.PhysicalInterfaces{
+			{IfName: "eth0"},
+			{IfName: "eth1", VLAN: "100"},
+			{IfName: "eth2"},
+			{IfName: "bond0"},
+		},
+		LogicalInterfaces: sshtool.LogicalInterfaces{
+			{IfName: "eth0", IfIP: "10.0.0.1/24"},
+			{IfName: "eth1.100", IfIP: "192.168.100.1/24"},
+		},
+		Routes: sshtool.Routes{
+			{Net: "0.0.0.0/0", Gateway: "10.0.0.254", Dev: "eth0"},
+		},
+		RouteInfo: []RouteInfo{
+			{Net: "10.5.0.0/16", Origin: originStatic, NextHops: []RouteNextHop{{Dev: "eth1.100"}}},
+		},
+		ClishConfig: mappingClish,
+	}
+
+	tests := []struct {
+		name			string
+		text			string
+		err			string
+		physical		sshtool.PhysicalInterfaces
+		logical		sshtool.LogicalInterfaces
+		route			string						// dev of the route
+		nextHop		string						// dev of the next hop
+		clish			string
+	}{
+		{
+			"rename", "eth0 = eth1-01\neth1 = eth1-02\neth2 = eth1-03\nbond0 = bond1\n", "",
+			sshtool.PhysicalInterfaces{
+				{IfName: "eth1-01"},
+				{IfName: "eth1-02", VLAN: "100"},
+				{IfName: "eth1-03"},
+				{IfName: "bond1"},
+			},
+			sshtool.LogicalInterfaces{
+				{IfName: "eth1-01", IfIP: "10.0.0.1/24"},
+				{IfName: "eth1-02.100", IfIP: "192.168.100.1/24"},
+			},
+			"eth1-01", "eth1-02.100",
+			`set hostname eth0
+set interface eth1-01 comments "eth0 uplink"
+set interface eth1-01 ipv4-address 10.0.0.1 mask-length 24
+add interface eth1-02 vlan 100
+set interface eth1-02.100 ipv4-address 192.168.100.1 mask-length 24
+add bonding group 1
+add bonding group 1 interface eth1-03
+set static-route 10.5.0.0/16 nexthop gateway logical eth1-02.100 on
+set snmp community eth1 read-only
+set interface lo ipv4-address 127.0.0.1 mask-length 8`,
+		},
+		{
+			"to vlan", "eth0 = eth1-01.120\neth1 = eth1-02\neth2 = eth1-03\nbond0 = bond0\n", "",
+			sshtool.PhysicalInterfaces{
+				{IfName: "eth1-01", VLAN: "120"},
+				{IfName: "eth1-02", VLAN: "100"},
+				{IfName: "eth1-03"},
+				{IfName: "bond0"},
+			},
+			sshtool.LogicalInterfaces{
+				{IfName: "eth1-01.120", IfIP: "10.0.0.1/24"},
+				{IfName: "eth1-02.100", IfIP: "192.168.100.1/24"},
+			},
+			"eth1-01.120", "eth1-02.100", "",
+		},
+		{
+			"missing", "eth0 = eth1-01\n", "no mapping for interface(s) bond0, eth1, eth2",
+			nil, nil, "", "", "",
+		},
+		{
+			"collision", "eth0 = eth1-02.100\neth1 = eth1-02\neth2 = eth1-03\nbond0 = bond1\n", "eth0 and eth1.100 are both mapped to eth1-02.100",
+			nil, nil, "", "", "",
+		},
+	}
+
+	for _, test := range tests {
+		imap, err := loadTestMap(t, test.text)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+
+		mapped, err := imap.Apply(hostData)
+
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, want '%s'", test.name, err, test.err)
+			}
+			if !reflect.DeepEqual(mapped, hostData) {
+				t.Errorf("%s: the host was changed although the map failed", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(mapped.PhysicalInterfaces, test.physical) {
+			t.Errorf("%s: physical interfaces\n got %v\nwant %v", test.name, mapped.PhysicalInterfaces, test.physical)
+		}
+		if !reflect.DeepEqual(mapped.LogicalInterfaces, test.logical) {
+			t.Errorf("%s: logical interfaces\n got %v\nwant %v", test.name, mapped.LogicalInterfaces, test.logical)
+		}
+		if mapped.Routes[0].Dev != test.route {
+			t.Errorf("%s: route dev %s, want %s", test.name, mapped.Routes[0].Dev, test.route)
+		}
+		if dev := mapped.RouteInfo[0].NextHops[0].Dev; dev != test.nextHop {
+			t.Errorf("%s: next hop dev %s, want %s", test.name, dev, test.nextHop)
+		}
+		if test.clish != "" && mapped.ClishConfig != test.clish {
+			t.Errorf("%s: clish\n got %s\nwant %s", test.name, mapped.ClishConfig, test.clish)
+		}
+		if hostData.LogicalInterfaces[0].IfName != "eth0" {
+			t.Fatalf("%s: Apply changed the source host", test.name)
+		}
+	}
+}
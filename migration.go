@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+)
+
+type ConfigGroup struct {
+	Name					string
+	Commands				[]string
+	Always					bool						// printed even when empty
+}
+
+//
+// MigrationConfig returns the clish commands which rebuild a gateway, in the order Gaia accepts them:
+// bonds before the VLANs and addresses on them, interfaces before the routes, aliases, proxy ARP and
+// DHCP relay which refer to them, and syslog and SNMP last. Interfaces and routes come from what was
+// collected, everything else from the 'show configuration' of the gateway, which may be nil
+//
+func MigrationConfig(hostData HostData, config *ClishConfig) (groups []ConfigGroup) {
+	bonds := make(map[string]bool)
+
+	for _, c := range config.Find("add", "bonding", "group") {
+		if len(c.Words) == 4 {
+			bonds["bond" + c.Words[3]] = true
+		}
+	}
+
+	var physical	sshtool.PhysicalInterfaces
+	var bondState	[]string
+
+	for _, i := range hostData.PhysicalInterfaces {
+		if bonds[i.IfName] {
+			bondState = appendUnique(bondState, "set interface " + i.IfName + " state on")
+		} else {
+			physical = append(physical, i)
+		}
+	}
+
+	physicalSettings, otherSettings := interfaceSettings(config, bonds)
+
+	groups = append(groups,
+		ConfigGroup{Name: "hostname",				Commands: config.lines("set", "hostname")},
+		ConfigGroup{Name: "DNS",					Commands: config.lines("set", "dns")},
+		ConfigGroup{Name: "NTP",					Commands: append(config.lines("set", "ntp"), config.lines("add", "ntp")...)},
+		ConfigGroup{Name: "physical interfaces",	Commands: append(physicalCommands(physical), physicalSettings...), Always: true},
+		ConfigGroup{Name: "bonds",					Commands: append(append(config.lines("add", "bonding"), config.lines("set", "bonding")...), bondState...)},
+		ConfigGroup{Name: "VLANs",					Commands: vlanCommands(hostData.PhysicalInterfaces), Always: true},
+		ConfigGroup{Name: "logical interfaces",	Commands: logicalCommands(hostData.LogicalInterfaces), Always: true},
+		ConfigGroup{Name: "interface settings",	Commands: otherSettings},
+		ConfigGroup{Name: "aliases",				Commands: config.interfaceLines("add", "alias")},
+		ConfigGroup{Name: "static routes",			Commands: routeCommands(staticRoutes(hostData, config)), Always: true},
+		ConfigGroup{Name: "proxy ARP",				Commands: config.lines("add", "arp", "proxy")},
+		ConfigGroup{Name: "DHCP relay",			Commands: append(config.lines("set", "bootp"), config.lines("set", "dhcp-relay")...)},
+		ConfigGroup{Name: "syslog",				Commands: append(config.lines("set", "syslog"), config.lines("add", "syslog")...)},
+		ConfigGroup{Name: "SNMP",					Commands: append(config.lines("set", "snmp"), config.lines("add", "snmp")...)},
+	)
+
+	return groups
+}
+
+//
+// interfaceSettings splits the MTU and comments of the interfaces into those of physical interfaces,
+// which can be set right away, and those of bonds and VLANs, which must exist first
+//
+func interfaceSettings(config *ClishConfig, bonds map[string]bool) (physical []string, other []string) {
+	for _, c := range config.Find("set", "interface") {
+		if len(c.Words) < 5 || (c.Words[3] != "mtu" && c.Words[3] != "comments") {
+			continue
+		}
+
+		if bonds[c.Words[2]] || strings.Contains(c.Words[2], ".") {
+			other = append(other, c.Text)
+		} else {
+			physical = append(physical, c.Text)
+		}
+	}
+
+	return physical, other
+}
+
+//
+//
+func (config *ClishConfig) lines(prefix ...string) (lines []string) {
+	for _, c := range config.Find(prefix...) {
+		lines = append(lines, c.Text)
+	}
+
+	return lines
+}
+
+//
+// interfaceLines returns '<verb> interface <name> <attribute> ...' commands
+//
+func (config *ClishConfig) interfaceLines(verb string, attribute string) (lines []string) {
+	for _, c := range config.Find(verb, "interface") {
+		if len(c.Words) > 3 && c.Words[3] == attribute {
+			lines = append(lines, c.Text)
+		}
+	}
+
+	return lines
+}
+
+//
+//
+func physicalCommands(physical sshtool.PhysicalInterfaces) (commands []string) {
+	// set interface eth1 state on
+	for _, i := range physical {
+		commands = appendUnique(commands, "set interface " + i.IfName + " state on")
+	}
+
+	return commands
+}
+
+//
+//
+func vlanCommands(physical sshtool.PhysicalInterfaces) (commands []string) {
+	// add interface eth1 vlan 111
+	for _, i := range physical {
+		if i.VLAN != "" {
+			commands = append(commands, "add interface " + i.IfName + " vlan " + i.VLAN)
+		}
+	}
+
+	return commands
+}
+
+//
+//
+func logicalCommands(logical sshtool.LogicalInterfaces) (commands []string) {
+	// set interface eth1.111 ipv4-address 192.168.1.1 mask-length 24
+	// set interface eth1.111 ipv6-address 2001:db8::1 mask-length 64
+	for _, i := range logical {
+		p := strings.Split(i.IfIP, "/")
+
+		family := "ipv4-address"
+
+		if isIPv6(i.IfIP) {
+			family = "ipv6-address"
+		}
+
+		if len(p) == 2 {
+			commands = append(commands, "set interface " + i.IfName + " " + family + " " + p[0] + " mask-length " + p[1])
+		} else if len(p) > 2 {
+			commands = append(commands, "set interface " + i.IfName + " " + family + " " + p[0] + " mask-length 32")
+		} else {
+			commands = append(commands, "# invalid ip/netmask")
+		}
+	}
+
+	return commands
+}
+
+//
+// routeCommands writes the next hops of a route one after the other; a next hop without a known priority
+// gets the default of Gaia
+//
+func routeCommands(routes []RouteInfo) (commands []string) {
+	// set static-route 192.168.2.0/24 nexthop gateway address 192.168.1.10 priority 1 on
+	// set static-route 192.168.3.0/24 nexthop gateway logical eth1 on
+	// set ipv6 static-route 2001:db8:1::/48 nexthop gateway 2001:db8::fe priority 1 on
+	// set static-route 192.168.4.0/24 nexthop blackhole
+	unknown := false
+
+	for _, r := range routes {
+		if r.Origin == "" && !unknown {
+			commands = append(commands, "# route origin unknown, every route through a gateway is taken as static")
+			unknown = true
+		}
+
+		ip, ipNet, err := net.ParseCIDR(r.Net)
+		if err != nil {
+			commands = append(commands, "# invalid route " + r.Net)
+			continue
+		}
+
+		dest := r.Net
+
+		if ones, _ := ipNet.Mask.Size(); ones == 0 && ip.IsUnspecified() {
+			dest = "default"
+		}
+
+		if r.Discard != "" && ip.To4() == nil {
+			commands = append(commands, "set ipv6 static-route " + dest + " nexthop " + r.Discard)
+		} else if r.Discard != "" {
+			commands = append(commands, "set static-route " + dest + " nexthop " + r.Discard)
+		}
+
+		for _, h := range r.NextHops {
+			var command string
+
+			if ip.To4() == nil && h.Gateway == "" {
+				command = "set ipv6 static-route " + dest + " nexthop gateway logical " + h.Dev
+			} else if ip.To4() == nil {
+				command = "set ipv6 static-route " + dest + " nexthop gateway " + h.Gateway
+			} else if h.Gateway == "" {
+				command = "set static-route " + dest + " nexthop gateway logical " + h.Dev
+			} else {
+				command = "set static-route " + dest + " nexthop gateway address " + h.Gateway
+			}
+
+			if h.Priority > 0 {
+				command += " priority " + strconv.Itoa(h.Priority)
+			}
+
+			commands = append(commands, command + " on")
+		}
+	}
+
+	return commands
+}
+
+//
+//
+func appendUnique(list []string, s string) (result []string) {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
@@ -23,13 +23,34 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"github.com/mikejac/ssh.golang"
 )
 
+type RouteMatch int
+
+const (
+	RouteExact		RouteMatch = iota					// same prefix, gateway and device
+	RouteDev											// same prefix and gateway, different device
+	RouteGateway										// same prefix, different gateway
+	RouteSupernet										// covered by a less specific route on the peer
+	RouteOverlap										// the peer has more specific routes inside this one
+	RouteMissing										// nothing on the peer overlaps
+)
+
+// the order in which route differences are reported
+var RouteMismatchOrder = []RouteMatch{RouteGateway, RouteDev, RouteSupernet, RouteOverlap, RouteMissing}
+
+type ComparedRoute struct {
+	Route					sshtool.NetworkRoute
+	Match					RouteMatch
+	Peers					sshtool.Routes				// the peer routes the match was made against
+}
+
 //
 //
 func CompareNetworks(routes1 sshtool.Routes, routes2 sshtool.Routes, verbose int) (sharedRoutes sshtool.Routes, host1OnlyRoutes sshtool.Routes, host2OnlyRoutes sshtool.Routes) {
-	if verbose >= 1 { fmt.Printf("CompareNetworks(): host1 routes in host2\n") }
+	if verbose >= 1 { fmt.Fprintf(verboseOut, "CompareNetworks(): host1 routes in host2\n") }
 	
 	for _, r1 := range routes1 {
 		if findNetwork(r1, routes2) {
@@ -39,7 +60,7 @@ func CompareNetworks(routes1 sshtool.Routes, routes2 sshtool.Routes, verbose int
 		}
 	}
 
-	if verbose >= 1 { fmt.Printf("CompareNetworks(): host2 routes in host1\n") }
+	if verbose >= 1 { fmt.Fprintf(verboseOut, "CompareNetworks(): host2 routes in host1\n") }
 	
 	for _, r2 := range routes2 {
 		if findNetwork(r2, routes1) {
@@ -50,15 +71,15 @@ func CompareNetworks(routes1 sshtool.Routes, routes2 sshtool.Routes, verbose int
 	}
 	
 	if verbose >= 1 {
-		fmt.Printf("CompareNetworks(): sharedRoutes:\n")
-		fmt.Printf("%q\n", sharedRoutes)
-		fmt.Println()
-		fmt.Printf("CompareNetworks(): host1OnlyRoutes:\n")
-		fmt.Printf("%q\n", host1OnlyRoutes)
-		fmt.Println()
-		fmt.Printf("CompareNetworks(): host2OnlyRoutes:\n")
-		fmt.Printf("%q\n", host2OnlyRoutes)
-		fmt.Println()
+		fmt.Fprintf(verboseOut, "CompareNetworks(): sharedRoutes:\n")
+		fmt.Fprintf(verboseOut, "%q\n", sharedRoutes)
+		fmt.Fprintln(verboseOut)
+		fmt.Fprintf(verboseOut, "CompareNetworks(): host1OnlyRoutes:\n")
+		fmt.Fprintf(verboseOut, "%q\n", host1OnlyRoutes)
+		fmt.Fprintln(verboseOut)
+		fmt.Fprintf(verboseOut, "CompareNetworks(): host2OnlyRoutes:\n")
+		fmt.Fprintf(verboseOut, "%q\n", host2OnlyRoutes)
+		fmt.Fprintln(verboseOut)
 	}
 	
 	return sharedRoutes, host1OnlyRoutes, host2OnlyRoutes
@@ -68,14 +89,213 @@ func CompareNetworks(routes1 sshtool.Routes, routes2 sshtool.Routes, verbose int
 //
 func findNetwork(n sshtool.NetworkRoute, routes sshtool.Routes) (found bool) {
 	for _, r := range routes {
-		if r.IPNet.IP.Equal(n.IPNet.IP) && r.IPNet.Mask.String() == n.IPNet.Mask.String() && r.Gateway == n.Gateway {
-			if verbose >= 1 { fmt.Printf("findNetwork(): found; %s / %s -> %s\n", n.IPNet.IP.String(), n.IPNet.Mask.String(), n.Gateway) }
+		if samePrefix(r, n) && r.Gateway == n.Gateway && r.Dev == n.Dev {
+			if verbose >= 1 { fmt.Fprintf(verboseOut, "findNetwork(): found; %s / %s -> %s\n", n.IPNet.IP.String(), n.IPNet.Mask.String(), n.Gateway) }
 			
 			return true
 		}
 	}
 
-	if verbose >= 1 { fmt.Printf("findNetwork(): NOT found; %s / %s -> %s\n", n.IPNet.IP.String(), n.IPNet.Mask.String(), n.Gateway) }
+	if verbose >= 1 { fmt.Fprintf(verboseOut, "findNetwork(): NOT found; %s / %s -> %s\n", n.IPNet.IP.String(), n.IPNet.Mask.String(), n.Gateway) }
 	
 	return false
-}
\ No newline at end of file
+}
+
+type ClusterRoute struct {
+	Route					sshtool.NetworkRoute
+	Present				[]string
+	Missing				[]string
+	Matches				[]ComparedRoute				// how the route compares on each of the 'Missing' members
+}
+
+type IgnoredRoute struct {
+	ClusterRoute
+	Rule					string						// the ignore rule which matched the route
+}
+
+//
+// CompareClusterRoutes compares the routes of any number of cluster members. Routes found on all members
+// are returned in sharedRoutes, every other route is returned once in partialRoutes together with the
+// members that have it and the members that lack it
+//
+func CompareClusterRoutes(members []string, routes map[string]sshtool.Routes, verbose int) (sharedRoutes sshtool.Routes, partialRoutes []ClusterRoute) {
+	var seen sshtool.Routes
+
+	for _, m := range members {
+		if verbose >= 1 { fmt.Fprintf(verboseOut, "CompareClusterRoutes(): %s routes in other members\n", m) }
+
+		for _, r := range routes[m] {
+			if findNetwork(r, seen) {
+				continue
+			}
+
+			seen = append(seen, r)
+
+			cr := ClusterRoute{Route: r}
+
+			for _, other := range members {
+				if other == m || findNetwork(r, routes[other]) {
+					cr.Present = append(cr.Present, other)
+				} else {
+					cr.Missing = append(cr.Missing, other)
+					cr.Matches = append(cr.Matches, ClassifyRoute(r, routes[other]))
+				}
+			}
+
+			if len(cr.Missing) == 0 {
+				sharedRoutes = append(sharedRoutes, r)
+			} else {
+				partialRoutes = append(partialRoutes, cr)
+			}
+		}
+	}
+
+	if verbose >= 1 {
+		fmt.Fprintf(verboseOut, "CompareClusterRoutes(): sharedRoutes:\n")
+		fmt.Fprintf(verboseOut, "%q\n", sharedRoutes)
+		fmt.Fprintln(verboseOut)
+		fmt.Fprintf(verboseOut, "CompareClusterRoutes(): partialRoutes:\n")
+		fmt.Fprintf(verboseOut, "%q\n", partialRoutes)
+		fmt.Fprintln(verboseOut)
+	}
+
+	return sharedRoutes, partialRoutes
+}
+
+
+//
+// Match returns the closest match the route has on any of the members missing it
+//
+func (cr ClusterRoute) Match() (match RouteMatch) {
+	match = RouteMissing
+
+	for _, m := range cr.Matches {
+		if m.Match < match {
+			match = m.Match
+		}
+	}
+
+	return match
+}
+
+//
+//
+func (match RouteMatch) String() string {
+	switch match {
+	case RouteExact:
+		return "exact"
+	case RouteDev:
+		return "dev"
+	case RouteGateway:
+		return "gateway"
+	case RouteSupernet:
+		return "supernet"
+	case RouteOverlap:
+		return "overlap"
+	}
+
+	return "missing"
+}
+
+//
+//
+func (match RouteMatch) Description() string {
+	switch match {
+	case RouteExact:
+		return "exact match"
+	case RouteDev:
+		return "same prefix, different dev"
+	case RouteGateway:
+		return "same prefix, different gateway"
+	case RouteSupernet:
+		return "covered by supernet"
+	case RouteOverlap:
+		return "partially overlapping"
+	}
+
+	return "not present on peer"
+}
+
+//
+// ClassifyRoutes classifies every route in 'routes' against the routes of the peer
+//
+func ClassifyRoutes(routes sshtool.Routes, peer sshtool.Routes) (compared []ComparedRoute) {
+	for _, r := range routes {
+		compared = append(compared, ClassifyRoute(r, peer))
+	}
+
+	return compared
+}
+
+//
+// ClassifyRoute finds out how closely 'n' is matched by the routes of a peer. The default route is
+// not considered a supernet as it would otherwise cover every route
+//
+func ClassifyRoute(n sshtool.NetworkRoute, routes sshtool.Routes) (compared ComparedRoute) {
+	var dev			sshtool.Routes
+	var gateway		sshtool.Routes
+	var supernet		sshtool.Routes
+	var overlap		sshtool.Routes
+
+	compared.Route = n
+
+	nNet := routeIPNet(n)
+	nLen, _ := nNet.Mask.Size()
+
+	for _, r := range routes {
+		rNet := routeIPNet(r)
+		rLen, _ := rNet.Mask.Size()
+
+		if samePrefix(r, n) {
+			if r.Gateway == n.Gateway && r.Dev == n.Dev {
+				compared.Match = RouteExact
+				compared.Peers = sshtool.Routes{r}
+
+				return compared
+			} else if r.Gateway == n.Gateway {
+				dev = append(dev, r)
+			} else {
+				gateway = append(gateway, r)
+			}
+		} else if !sameFamily(r, n) {
+			continue
+		} else if rLen > 0 && rLen < nLen && rNet.Contains(nNet.IP) {
+			supernet = append(supernet, r)
+		} else if nLen < rLen && nNet.Contains(rNet.IP) {
+			overlap = append(overlap, r)
+		}
+	}
+
+	if len(dev) > 0 {
+		compared.Match, compared.Peers = RouteDev, dev
+	} else if len(gateway) > 0 {
+		compared.Match, compared.Peers = RouteGateway, gateway
+	} else if len(supernet) > 0 {
+		compared.Match, compared.Peers = RouteSupernet, supernet
+	} else if len(overlap) > 0 {
+		compared.Match, compared.Peers = RouteOverlap, overlap
+	} else {
+		compared.Match = RouteMissing
+	}
+
+	if verbose >= 1 { fmt.Fprintf(verboseOut, "ClassifyRoute(): %s -> %s; %s\n", n.Net, n.Gateway, compared.Match.Description()) }
+
+	return compared
+}
+
+//
+//
+func samePrefix(r1 sshtool.NetworkRoute, r2 sshtool.NetworkRoute) (same bool) {
+	return r1.IPNet.IP.Equal(r2.IPNet.IP) && r1.IPNet.Mask.String() == r2.IPNet.Mask.String()
+}
+
+//
+//
+func routeIPNet(r sshtool.NetworkRoute) (ipNet *net.IPNet) {
+	ip := r.IPNet.IP.To4()
+	if ip == nil {
+		ip = r.IPNet.IP
+	}
+
+	return &net.IPNet{IP: ip, Mask: r.IPNet.Mask}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+//
+func TestClassifyRoute(t *testing.T) {
+	peer := testRoutes(t,
+		"0.0.0.0/0 10.0.0.254 eth0",
+		"10.1.0.0/16 10.0.0.1 eth0",
+		"10.2.0.0/16 10.0.0.2 eth0",
+		"10.4.0.0/16 10.0.0.1 eth0",
+		"10.4.2.128/25 10.0.0.1 eth0",
+		"10.5.1.0/24 10.0.0.1 eth0",
+		"2001:db8::/32 2001:db8::fe eth0",
+	)
+
+	tests := []struct {
+		route			string
+		match			RouteMatch
+		peers			[]string
+	}{
+		{"10.1.0.0/16 10.0.0.1 eth0",		RouteExact,		[]string{"10.1.0.0/16"}},
+		{"10.1.0.0/16 10.0.0.1 eth1",		RouteDev,			[]string{"10.1.0.0/16"}},
+		{"10.2.0.0/16 10.0.0.1 eth0",		RouteGateway,		[]string{"10.2.0.0/16"}},
+		{"10.1.2.0/24 10.0.0.1 eth0",		RouteSupernet,	[]string{"10.1.0.0/16"}},
+		{"10.4.2.0/24 10.0.0.1 eth0",		RouteSupernet,	[]string{"10.4.0.0/16"}},		// a supernet wins over an overlap
+		{"10.5.0.0/16 10.0.0.1 eth0",		RouteOverlap,		[]string{"10.5.1.0/24"}},
+		{"10.9.0.0/16 10.0.0.1 eth0",		RouteMissing,		nil},							// the default route is no supernet
+		{"2001:db8:1::/48 2001:db8::fe eth0",	RouteSupernet,	[]string{"2001:db8::/32"}},
+		{"2001:db9::/32 2001:db8::fe eth0",	RouteMissing,		nil},
+	}
+
+	for _, test := range tests {
+		compared := ClassifyRoute(testRoutes(t, test.route)[0], peer)
+
+		var peers []string
+
+		for _, p := range compared.Peers {
+			peers = append(peers, p.Net)
+		}
+
+		if compared.Match != test.match || !reflect.DeepEqual(peers, test.peers) {
+			t.Errorf("%s: got %s %v, want %s %v", test.route, compared.Match, peers, test.match, test.peers)
+		}
+	}
+}
+
+//
+// a route missing on several members is reported once, with how it compares on each of them
+//
+func TestCompareClusterRoutes(t *testing.T) {
+	members := []string{"fwa", "fwb", "fwc"}
+
+	routes := map[string]sshtool.Routes{
+		"fwa": testRoutes(t, "10.1.0.0/16 10.0.0.1 eth0", "10.2.0.0/16 10.0.0.1 eth0", "10.3.0.0/24 10.0.0.1 eth0"),
+		"fwb": testRoutes(t, "10.1.0.0/16 10.0.0.1 eth0", "10.2.0.0/16 10.0.0.2 eth0", "10.3.0.0/16 10.0.0.1 eth0"),
+		"fwc": testRoutes(t, "10.1.0.0/16 10.0.0.1 eth0", "10.3.0.0/24 10.0.0.1 eth0"),
+	}
+
+	shared, partial := CompareClusterRoutes(members, routes, 0)
+
+	if len(shared) != 1 || shared[0].Net != "10.1.0.0/16" {
+		t.Errorf("shared: got %v", shared)
+	}
+
+	var got []string
+
+	for _, cr := range partial {
+		var matches []string
+
+		for _, m := range cr.Matches {
+			matches = append(matches, m.Match.String())
+		}
+
+		got = append(got, cr.Route.Net + " " + cr.Route.Gateway + " present " + strings.Join(cr.Present, ",") + " missing " + strings.Join(cr.Missing, ",") +
+			" " + strings.Join(matches, ",") + " -> " + cr.Match().String())
+	}
+
+	want := []string{
+		"10.2.0.0/16 10.0.0.1 present fwa missing fwb,fwc gateway,missing -> gateway",
+		"10.3.0.0/24 10.0.0.1 present fwa,fwc missing fwb supernet -> supernet",
+		"10.2.0.0/16 10.0.0.2 present fwb missing fwa,fwc gateway,missing -> gateway",
+		"10.3.0.0/16 10.0.0.1 present fwb missing fwa,fwc overlap,overlap -> overlap",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("partial routes:\n got %q\nwant %q", got, want)
+	}
+}
@@ -22,13 +22,201 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"os/exec"
+	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"os"
+	"github.com/go-ini/ini"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+//
+// credentials are looked up in the sources listed in 'credential_sources' in the [defaults] section of
+// the hosts file, in that order:
+//
+//   env     CKPTOOL_SSH_PASSWORD, CKPTOOL_EXPERT_PASSWORD, CKPTOOL_JUMP_PASSWORD, CKPTOOL_VAULT_PASSWORD
+//   file    'credentials_file' (default ~/.ckptool/credentials); ssh_password = ..., expert_password = ...,
+//           jump_password = ..., vault_password = ...
+//           the file must not be readable by group or others
+//   helper  'credential_helper' is run as '<helper> get ssh' and prints the password on stdout
+//   prompt  ask on the terminal
+//
+type CredentialStore struct {
+	sources				[]string
+	file					string
+	helper					string
+
+	mutex					sync.Mutex
+	cache					map[string]credential
+}
+
+type credential struct {
+	password				string
+	ok						bool
+}
+
+const (
+	credSSH				= "ssh"
+	credExpert				= "expert"
+	credJump				= "jump"
+	credVault				= "vault"
+
+	defaultCredentialSources	= "env,file,helper,prompt"
+	defaultCredentialsFile	= "~/.ckptool/credentials"
+)
+
+//
+//
+func NewCredentialStore(hosts *HostsData) (store *CredentialStore, err error) {
+	store = &CredentialStore{
+		file:	defaultCredentialsFile,
+		cache:	make(map[string]credential),
+	}
+
+	sources := defaultCredentialSources
+
+	if val, ok := hosts.GetDefault("credential_sources"); ok {
+		sources = val
+	}
+	if val, ok := hosts.GetDefault("credentials_file"); ok {
+		store.file = val
+	}
+	if val, ok := hosts.GetDefault("credential_helper"); ok {
+		store.helper = val
+	}
+
+	for _, s := range strings.Split(sources, ",") {
+		s = strings.TrimSpace(s)
+
+		switch s {
+		case "env", "file", "helper", "prompt":
+			store.sources = append(store.sources, s)
+		default:
+			return nil, fmt.Errorf("unknown credential source '%s'", s)
+		}
+	}
+
+	return store, nil
+}
+
+//
+// Get returns the password of the given kind from the first source which has it. Passwords are only
+// looked up once; hosts collected in parallel wait for the first lookup to finish
+//
+func (store *CredentialStore) Get(kind string, prompt string) (password string, ok bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if c, found := store.cache[kind]; found {
+		return c.password, c.ok
+	}
+
+	password, ok = store.lookup(kind, prompt)
+
+	store.cache[kind] = credential{password, ok}
+
+	return password, ok
+}
+
+//
+//
+func (store *CredentialStore) lookup(kind string, prompt string) (password string, ok bool) {
+	var tried []string
+
+	for _, s := range store.sources {
+		var err error
+
+		switch s {
+		case "env":
+			password, ok = os.LookupEnv("CKPTOOL_" + strings.ToUpper(kind) + "_PASSWORD")
+		case "file":
+			password, ok, err = store.fromFile(kind)
+		case "helper":
+			password, ok, err = store.fromHelper(kind)
+		case "prompt":
+			if terminal.IsTerminal(int(syscall.Stdin)) {
+				password, ok = Credentials(prompt)
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: credential %s: %s\n", s, err.Error())
+		}
+		if ok {
+			return password, true
+		}
+
+		tried = append(tried, s)
+	}
+
+	fmt.Fprintf(os.Stderr, "ERROR: no %s password available (tried %s)\n", kind, strings.Join(tried, ", "))
+
+	return "", false
+}
+
+//
+//
+func (store *CredentialStore) fromFile(kind string) (password string, ok bool, err error) {
+	file := expandHome(store.file)
+
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	if runtime.GOOS != "windows" && (info.Mode().Perm() & 0077) != 0 {
+		return "", false, fmt.Errorf("%s is accessible by group or others (mode %04o); refusing to use it", file, info.Mode().Perm())
+	}
+
+	cfg, err := ini.Load(file)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !cfg.Section("").HasKey(kind + "_password") {
+		return "", false, nil
+	}
+
+	return cfg.Section("").Key(kind + "_password").String(), true, nil
+}
+
+//
+//
+func (store *CredentialStore) fromHelper(kind string) (password string, ok bool, err error) {
+	if store.helper == "" {
+		return "", false, nil
+	}
+
+	args := strings.Fields(store.helper)
+	args = append(args, "get", kind)
+
+	var stdout bytes.Buffer
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err = cmd.Run(); err != nil {
+		return "", false, fmt.Errorf("%s: %s", store.helper, err.Error())
+	}
+
+	line, _ := bufio.NewReader(&stdout).ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+
+	if line == "" {
+		return "", false, nil
+	}
+
+	return line, true, nil
+}
+
 //
 //
 func Credentials(prompt string) (password string, ok bool) {
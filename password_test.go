@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//
+// newTestCredentialStore writes a hosts file with the given [defaults] and creates the store from it
+//
+func newTestCredentialStore(t *testing.T, dir string, defaults string) (store *CredentialStore, err error) {
+	file := filepath.Join(dir, "hosts.ini")
+
+	if err = ioutil.WriteFile(file, []byte("[defaults]\n" + defaults), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := NewHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewCredentialStore(hosts)
+}
+
+//
+// every kind of password comes from the first source which has it: the environment, then the
+// credentials file, which must be private, then the helper
+//
+func TestCredentialStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "ckptool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentials	:= filepath.Join(dir, "credentials")
+	shared		:= filepath.Join(dir, "shared")
+	helper		:= filepath.Join(dir, "helper")
+
+	for _, f := range []string{credentials, shared} {
+		if err = ioutil.WriteFile(f, []byte("ssh_password = file-ssh\nexpert_password = file-expert\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Chmod(shared, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(helper, []byte("#!/bin/sh\n[ \"$2\" = jump ] && echo helper-$2\nexit 0\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kind := range []string{credSSH, credExpert, credJump, credVault} {
+		os.Unsetenv("CKPTOOL_" + strings.ToUpper(kind) + "_PASSWORD")
+	}
+
+	os.Setenv("CKPTOOL_SSH_PASSWORD", "env-ssh")
+	defer os.Unsetenv("CKPTOOL_SSH_PASSWORD")
+
+	tests := []struct {
+		name			string
+		file			string
+		kind			string
+		password		string
+		ok				bool
+	}{
+		{"env first",				credentials,	credSSH,		"env-ssh",			true},
+		{"file",					credentials,	credExpert,	"file-expert",		true},
+		{"helper",					credentials,	credJump,		"helper-jump",		true},
+		{"nowhere",				credentials,	credVault,		"",					false},
+		{"shared file refused",	shared,		credExpert,	"",					false},
+	}
+
+	for _, test := range tests {
+		store, err := newTestCredentialStore(t, dir, "credential_sources = env,file,helper\ncredentials_file = " + test.file + "\ncredential_helper = " + helper + "\n")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+
+		if password, ok := store.Get(test.kind, ""); password != test.password || ok != test.ok {
+			t.Errorf("%s: got %q %t, want %q %t", test.name, password, ok, test.password, test.ok)
+		}
+	}
+
+	// a password is only looked up once
+	store, err := newTestCredentialStore(t, dir, "credential_sources = env\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Get(credSSH, "")
+	os.Setenv("CKPTOOL_SSH_PASSWORD", "changed")
+
+	if password, _ := store.Get(credSSH, ""); password != "env-ssh" {
+		t.Errorf("cache: got %q", password)
+	}
+
+	if _, err = newTestCredentialStore(t, dir, "credential_sources = env,keyring\n"); err == nil {
+		t.Errorf("an unknown credential source was accepted")
+	}
+}
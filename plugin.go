@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// Nagios/Icinga plugin output; see https://nagios-plugins.org/doc/guidelines.html
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pluginOk					int = 0
+	pluginWarning				int = 1
+	pluginCritical			int = 2
+	pluginUnknown				int = 3
+)
+
+var pluginStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+type PluginResult struct {
+	Status					int
+	Text					string
+	Perfdata				[]string
+}
+
+//
+// PluginHost maps the result of checkStandalone() to a plugin result. A host which can't be reached
+// is critical, a host where some of the information couldn't be retrieved is a warning
+//
+func PluginHost(hostData HostData) (result PluginResult) {
+	var problems []string
+
+	if (hostData.Errors & errConnect) != 0 {
+		result.Status = pluginCritical
+		problems = append(problems, "could not connect: " + hostData.ConnectText)
+	} else if hostData.Errors != 0 {
+		result.Status = pluginWarning
+
+		for _, e := range hostErrorNames {
+			if (hostData.Errors & e.bit) != 0 {
+				problems = append(problems, "could not retrieve " + e.name)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		result.Text = fmt.Sprintf("host %s: %s", hostData.Name, strings.Join(problems, ", "))
+	} else {
+		result.Text = fmt.Sprintf("host %s: fwver \"%s\", cpha \"%s\"", hostData.Name, hostData.FwVer, cphaStatus(hostData.Cpha))
+	}
+
+	result.Perfdata = pluginHostPerfdata("", hostData)
+
+	return result
+}
+
+//
+// PluginCluster maps the result of checkCluster() to a plugin result. Unreachable members and a broken
+// CPHA state are critical, route or interface mismatches and incomplete information are warnings
+//
+func PluginCluster(clusterData ClusterData) (result PluginResult) {
+	var problems []string
+
+	if len(clusterData.Members) < 2 {
+		result.Status = pluginUnknown
+		result.Text = fmt.Sprintf("cluster %s: cluster does not contain at least two members", clusterData.Name)
+
+		return result
+	}
+
+	for _, m := range clusterData.Members {
+		h := clusterData.Hosts[m]
+
+		if (h.Errors & errConnect) != 0 {
+			result.Status = pluginMax(result.Status, pluginCritical)
+			problems = append(problems, "could not connect to " + m)
+		} else if h.Errors != 0 {
+			result.Status = pluginMax(result.Status, pluginWarning)
+			problems = append(problems, "incomplete information from " + m)
+		}
+
+		result.Perfdata = append(result.Perfdata, pluginHostPerfdata(m + "_", h)...)
+	}
+
+	if (clusterData.Errors & errMembers) != 0 {
+		result.Status = pluginMax(result.Status, pluginCritical)
+		problems = append(problems, "members not found")
+	}
+	if (clusterData.Errors & errCphaStat) != 0 {
+		result.Status = pluginMax(result.Status, pluginCritical)
+		problems = append(problems, "CPHA not working")
+	}
+	if (clusterData.Errors & errRouteMismatch) != 0 {
+		result.Status = pluginMax(result.Status, pluginWarning)
+		problems = append(problems, fmt.Sprintf("%d mismatched routes", len(clusterData.Mismatches)))
+	}
+	if (clusterData.Errors & errInterfaceMismatch) != 0 {
+		result.Status = pluginMax(result.Status, pluginWarning)
+		problems = append(problems, fmt.Sprintf("%d interface mismatches", len(clusterData.InterfaceMismatches)))
+	}
+
+	if len(problems) > 0 {
+		result.Text = fmt.Sprintf("cluster %s: %s", clusterData.Name, strings.Join(problems, ", "))
+	} else {
+		result.Text = fmt.Sprintf("cluster %s: %d members, routes and interfaces match", clusterData.Name, len(clusterData.Members))
+	}
+
+	result.Perfdata = append(result.Perfdata,
+		fmt.Sprintf("mismatched_routes=%d;1;;0", len(clusterData.Mismatches)),
+		fmt.Sprintf("ignored_routes=%d;;;0", len(clusterData.Ignored)),
+		fmt.Sprintf("interface_mismatches=%d;1;;0", len(clusterData.InterfaceMismatches)))
+
+	return result
+}
+
+//
+//
+func pluginHostPerfdata(prefix string, hostData HostData) (perfdata []string) {
+	perfdata = append(perfdata, fmt.Sprintf("'%sroutes'=%d;;;0", prefix, len(hostData.Routes)))
+	perfdata = append(perfdata, fmt.Sprintf("'%slogical_interfaces'=%d;;;0", prefix, len(hostData.LogicalInterfaces)))
+	perfdata = append(perfdata, fmt.Sprintf("'%sphysical_interfaces'=%d;;;0", prefix, len(hostData.PhysicalInterfaces)))
+
+	return perfdata
+}
+
+//
+//
+func pluginMax(status1 int, status2 int) (status int) {
+	if status1 > status2 {
+		return status1
+	}
+
+	return status2
+}
+
+//
+// PrintPlugin writes the single status line and returns the exit code of the plugin
+//
+func PrintPlugin(writer io.Writer, result PluginResult) (exitCode int) {
+	fmt.Fprintf(writer, "CKPTOOL %s - %s", pluginStatusNames[result.Status], result.Text)
+
+	if len(result.Perfdata) > 0 {
+		fmt.Fprintf(writer, " | %s", strings.Join(result.Perfdata, " "))
+	}
+
+	fmt.Fprintln(writer)
+
+	return result.Status
+}
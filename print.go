@@ -44,79 +44,28 @@ func NewPrint(writer io.Writer) (print *PrintData) {
 //
 //
 func (print *PrintData) PrintInterfaces(physical sshtool.PhysicalInterfaces, logical sshtool.LogicalInterfaces) {
-	var used map[string]bool
-	used = make(map[string]bool, 0)
-
-	print.writer.Write([]byte("# physical interfaces\n"))	
-	
-	// set interface eth1 state on
-	for _, i := range physical {
-		if _, ok := used[i.IfName]; !ok {
-			print.writer.Write([]byte("set interface "))
-			print.writer.Write([]byte(i.IfName))
-			print.writer.Write([]byte(" state on\n"))		
-			
-			used[i.IfName] = true
-		}			
-	}
-
-	print.writer.Write([]byte("# VLANs\n"))
-
-	// add interface eth1 vlan 111
-	for _, i := range physical {
-		if i.VLAN != "" {
-			print.writer.Write([]byte("add interface "))
-			print.writer.Write([]byte(i.IfName))
-			print.writer.Write([]byte(" vlan "))		
-			print.writer.Write([]byte(i.VLAN))
-			print.writer.Write([]byte("\n"))
-		}			
-	}
+	print.PrintConfigGroup(ConfigGroup{Name: "physical interfaces", Commands: physicalCommands(physical), Always: true})
+	print.PrintConfigGroup(ConfigGroup{Name: "VLANs", Commands: vlanCommands(physical), Always: true})
+	print.PrintConfigGroup(ConfigGroup{Name: "logical interfaces", Commands: logicalCommands(logical), Always: true})
+}
 
-	print.writer.Write([]byte("# logical interfaces\n"))
-
-	// set interface eth1.111 ipv4-address 192.168.1.1 mask-length 24
-	for _, i := range logical {
-		p := strings.Split(i.IfIP, "/")
-		
-		if len(p) > 1 {
-			print.writer.Write([]byte("set interface "))
-			print.writer.Write([]byte(i.IfName))
-			print.writer.Write([]byte(" ipv4-address "))
-			print.writer.Write([]byte(p[0]))
-			print.writer.Write([]byte(" mask-length "))
-			
-			if len(p) == 2 {
-				print.writer.Write([]byte(p[1]))
-			} else {
-				print.writer.Write([]byte("32"))
-			}
-			
-			print.writer.Write([]byte("\n"))
-		} else {
-			print.writer.Write([]byte("# invalid ip/netmask\n"))
-		}
-	}
+//
+//
+func (print *PrintData) PrintRoutes(routes []RouteInfo) {
+	print.PrintConfigGroup(ConfigGroup{Name: "static routes", Commands: routeCommands(routes), Always: true})
 }
 
 //
 //
-func (print *PrintData) PrintRoutes(routes sshtool.Routes) {
-	print.writer.Write([]byte("# static routes\n"))	
+func (print *PrintData) PrintConfigGroup(group ConfigGroup) {
+	if len(group.Commands) == 0 && !group.Always {
+		return
+	}
 
-	// set static-route 192.168.2.0/24 nexthop gateway address 192.168.1.10 priority 1 on
-	for _, r := range routes {
-		print.writer.Write([]byte("set static-route "))
-		
-		if r.IPNet.IP.String() == "0.0.0.0" {
-			print.writer.Write([]byte("default"))			
-		} else {		
-			print.writer.Write([]byte(r.Net))
-		}
-		
-		print.writer.Write([]byte(" nexthop gateway address "))
-		print.writer.Write([]byte(r.Gateway))
-		print.writer.Write([]byte(" priority 1 on\n"))
+	fmt.Fprintf(print.writer, "# %s\n", group.Name)
+
+	for _, c := range group.Commands {
+		fmt.Fprintln(print.writer, c)
 	}
 }
 
@@ -124,13 +73,19 @@ func (print *PrintData) PrintRoutes(routes sshtool.Routes) {
 //
 func (print *PrintData) PrintCPHA(cpha *sshtool.CphaData) {
 	print.writer.Write([]byte("# cpha state: "))
-	print.writer.Write([]byte(cpha.Status))
+
+	if cpha != nil {
+		print.writer.Write([]byte(cpha.Status))
+	} else {
+		print.writer.Write([]byte("null"))
+	}
+
 	print.writer.Write([]byte("\n"))
 }
 
 //
 //
-func (print *PrintData) PrintComparedRoutes(sharedRoutes sshtool.Routes, host1OnlyRoutes sshtool.Routes, host2OnlyRoutes sshtool.Routes, ignoredRoutes map[string]struct{}) {
+func (print *PrintData) PrintComparedRoutes(host1 string, host2 string, sharedRoutes sshtool.Routes, host1OnlyRoutes []ComparedRoute, host2OnlyRoutes []ComparedRoute, ignoredRoutes RouteIgnoreRules) {
 	fmt.Fprintf(print.writer, "Shared Routes (%d)\n", len(sharedRoutes))
 	fmt.Fprintln(print.writer, "========================================================")
 	
@@ -146,31 +101,109 @@ func (print *PrintData) PrintComparedRoutes(sharedRoutes sshtool.Routes, host1On
 	fmt.Fprintf(print.writer, "Host 1 Routes (%d)\n", len(host1OnlyRoutes))
 	fmt.Fprintln(print.writer, "========================================================")
 	
-	if len(host1OnlyRoutes) == 0 {
+	print.printComparedRoutes(host1, host1OnlyRoutes, ignoredRoutes)
+
+	fmt.Fprintln(print.writer)
+	fmt.Fprintf(print.writer, "Host 2 Routes (%d)\n", len(host2OnlyRoutes))
+	fmt.Fprintln(print.writer, "========================================================")
+	
+	print.printComparedRoutes(host2, host2OnlyRoutes, ignoredRoutes)
+}
+
+//
+//
+func (print *PrintData) printComparedRoutes(member string, routes []ComparedRoute, ignoredRoutes RouteIgnoreRules) {
+	if len(routes) == 0 {
 		fmt.Fprintln(print.writer, "(none)")
-	} else {
-		for _, r := range host1OnlyRoutes {
-			if _, ok := ignoredRoutes[r.Net]; !ok {
+		return
+	}
+
+	for _, match := range RouteMismatchOrder {
+		var matched []ComparedRoute
+
+		for _, cr := range routes {
+			if cr.Match == match {
+				matched = append(matched, cr)
+			}
+		}
+
+		if len(matched) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(print.writer, "# %s (%d)\n", match.Description(), len(matched))
+
+		for _, cr := range matched {
+			r := cr.Route
+
+			if rule, ignored := ignoredRoutes.Match(member, r); !ignored {
 				fmt.Fprintf(print.writer, "%-20s -> %-16s dev %s\n", r.Net, r.Gateway, r.Dev)
 			} else {
-				fmt.Fprintf(print.writer, "Ignored: %-20s -> %-16s\n", r.Net, r.Gateway)				
+				fmt.Fprintf(print.writer, "Ignored: %-20s -> %-16s (rule: %s)\n", r.Net, r.Gateway, rule)
+			}
+
+			for _, p := range cr.Peers {
+				fmt.Fprintf(print.writer, "  peer: %-20s -> %-16s dev %s\n", p.Net, p.Gateway, p.Dev)
 			}
 		}
 	}
+}
+
+//
+//
+func (print *PrintData) PrintInterfaceMismatches(mismatches []InterfaceMismatch) {
+	fmt.Fprintf(print.writer, "Interface Mismatches (%d)\n", len(mismatches))
+	fmt.Fprintln(print.writer, "========================================================")
+
+	if len(mismatches) == 0 {
+		fmt.Fprintln(print.writer, "(none)")
+	} else {
+		for _, im := range mismatches {
+			fmt.Fprintln(print.writer, im.Description())
+		}
+	}
 
 	fmt.Fprintln(print.writer)
-	fmt.Fprintf(print.writer, "Host 2 Routes (%d)\n", len(host2OnlyRoutes))
+}
+
+//
+//
+func (print *PrintData) PrintClusterRoutes(sharedRoutes sshtool.Routes, partialRoutes []ClusterRoute, ignoredRoutes RouteIgnoreRules) {
+	fmt.Fprintf(print.writer, "Shared Routes (%d)\n", len(sharedRoutes))
 	fmt.Fprintln(print.writer, "========================================================")
 	
-	if len(host2OnlyRoutes) == 0 {
+	if len(sharedRoutes) == 0 {
 		fmt.Fprintln(print.writer, "(none)")
 	} else {
-		for _, r := range host2OnlyRoutes {
-			if _, ok := ignoredRoutes[r.Net]; !ok {
-				fmt.Fprintf(print.writer, "%-20s -> %-16s dev %s\n", r.Net, r.Gateway, r.Dev)
+		for _, r := range sharedRoutes {
+			fmt.Fprintf(print.writer, "%-20s -> %-16s dev %s\n", r.Net, r.Gateway, r.Dev)
+		}
+	}
+
+	fmt.Fprintln(print.writer)
+	fmt.Fprintf(print.writer, "Partial Routes (%d)\n", len(partialRoutes))
+	fmt.Fprintln(print.writer, "========================================================")
+	
+	if len(partialRoutes) == 0 {
+		fmt.Fprintln(print.writer, "(none)")
+	} else {
+		for _, cr := range partialRoutes {
+			if rule, ignored := ignoredRoutes.MatchAll(cr.Present, cr.Route); !ignored {
+				fmt.Fprintf(print.writer, "%-20s -> %-16s dev %s\n", cr.Route.Net, cr.Route.Gateway, cr.Route.Dev)
 			} else {
-				fmt.Fprintf(print.writer, "Ignored: %-20s -> %-16s\n", r.Net, r.Gateway)				
+				fmt.Fprintf(print.writer, "Ignored: %-20s -> %-16s (rule: %s)\n", cr.Route.Net, cr.Route.Gateway, rule)
+			}
+
+			fmt.Fprintf(print.writer, "  present on: %s\n", strings.Join(cr.Present, ", "))
+			fmt.Fprintf(print.writer, "  missing on: %s\n", strings.Join(cr.Missing, ", "))
+
+			for index, m := range cr.Matches {
+				fmt.Fprintf(print.writer, "  %s: %s\n", cr.Missing[index], m.Match.Description())
+
+				for _, p := range m.Peers {
+					fmt.Fprintf(print.writer, "    peer: %-20s -> %-16s dev %s\n", p.Net, p.Gateway, p.Dev)
+				}
 			}
 		}
 	}
-}
\ No newline at end of file
+}
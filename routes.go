@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// the routes of sshtool are one gateway per line without origin or priority. RouteInfo keeps what the
+// routing table of Gaia knows about a route: where it came from, its cost and all of its next hops. The
+// priorities of static next hops are only found in the configuration
+//
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"github.com/mikejac/ssh.golang"
+)
+
+const (
+	originStatic		= "static"
+	originConnected	= "connected"
+	originKernel		= "kernel"
+	originOSPF			= "ospf"
+	originBGP			= "bgp"
+	originRIP			= "rip"
+	originAggregate	= "aggregate"
+)
+
+var routeOrigins = map[string]string{
+	"S":	originStatic,
+	"C":	originConnected,
+	"K":	originKernel,
+	"O":	originOSPF,
+	"B":	originBGP,
+	"R":	originRIP,
+	"A":	originAggregate,
+}
+
+type RouteNextHop struct {
+	Gateway				string						`json:"gateway,omitempty"`
+	Dev						string						`json:"dev,omitempty"`
+	Priority				int							`json:"priority,omitempty"`		// 0 when not known
+}
+
+type RouteInfo struct {
+	Net						string						`json:"net"`
+	Origin					string						`json:"origin"`
+	Metric					int							`json:"metric"`
+	NextHops				[]RouteNextHop				`json:"next_hops"`
+	Discard				string						`json:"discard,omitempty"`		// blackhole or reject, without next hops
+}
+
+//
+// fetchRouteInfo returns the routing table of a gateway from 'show route' and 'show ipv6 route', or the
+// captured one when replaying. A gateway without IPv6 has just the IPv4 routes
+//
+func fetchRouteInfo(conn ConnSettings) (info []RouteInfo, err error) {
+	if conn.Replay != "" {
+		gateway, err := NewReplayGateway(conn.Replay, conn.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(gateway.host.RouteInfo) == 0 {
+			return nil, errNotCaptured
+		}
+
+		return gateway.host.RouteInfo, nil
+	}
+
+	text, err := runClish(conn, "show route")
+	if err != nil {
+		return nil, err
+	}
+
+	info = parseShowRoute(text)
+
+	if text, err := runClish(conn, "show ipv6 route"); err == nil {
+		info = append(info, parseShowRoute(text)...)
+	}
+
+	return info, nil
+}
+
+//
+// parseShowRoute reads 'show route' and 'show ipv6 route'; a route with several next hops continues on
+// the following lines
+//
+//   S         172.16.0.0/12       via 192.168.100.254, eth1.100, cost 0, age 100
+//                                 via 192.168.100.253, eth1.100, cost 0, age 100
+//   C         10.0.0.0/24         is directly connected, eth0
+//   O IA      10.5.0.0/16         via 10.0.0.5, eth0, cost 20, age 50
+//
+func parseShowRoute(text string) (info []RouteInfo) {
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(strings.Replace(line, ",", " ", -1))
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			// another next hop of the route above
+			if len(info) > 0 && fields[0] == "via" {
+				r := &info[len(info) - 1]
+				r.NextHops = append(r.NextHops, showRouteNextHop(fields, &r.Metric))
+			}
+
+			continue
+		}
+
+		for i, f := range fields {
+			_, ipNet, err := net.ParseCIDR(f)
+			if err != nil {
+				continue
+			}
+
+			origin, found := routeOrigins[fields[0]]
+			if !found {
+				origin = strings.ToLower(fields[0])
+			}
+
+			r := RouteInfo{Net: ipNet.String(), Origin: origin}
+
+			if i + 1 < len(fields) && fields[i + 1] == "via" {
+				r.NextHops = append(r.NextHops, showRouteNextHop(fields[i + 1:], &r.Metric))
+			} else if n := len(fields); n > i + 1 && fields[n - 2] == "connected" {
+				r.NextHops = append(r.NextHops, RouteNextHop{Dev: fields[n - 1]})
+			}
+
+			info = append(info, r)
+			break
+		}
+	}
+
+	return info
+}
+
+//
+// showRouteNextHop reads 'via <gateway> <dev> cost <n> ...' with the commas removed
+//
+func showRouteNextHop(fields []string, metric *int) (nextHop RouteNextHop) {
+	if len(fields) > 1 {
+		nextHop.Gateway = fields[1]
+	}
+	if len(fields) > 2 && fields[2] != "cost" {
+		nextHop.Dev = fields[2]
+	}
+
+	for i := 1; i + 1 < len(fields); i++ {
+		if fields[i] == "cost" {
+			*metric, _ = strconv.Atoi(fields[i + 1])
+		}
+	}
+
+	return nextHop
+}
+
+//
+// StaticRoutes returns the static routes of the configuration with all their next hops and priorities
+//
+//   set static-route 10.1.0.0/16 nexthop gateway address 10.0.0.254 priority 2 on
+//   set static-route 10.2.0.0/16 nexthop gateway logical eth1 on
+//   set static-route 10.3.0.0/16 nexthop blackhole
+//   set ipv6 static-route 2001:db8:1::/48 nexthop gateway 2001:db8::fe priority 1 on
+//
+func (config *ClishConfig) StaticRoutes() (routes []RouteInfo) {
+	index := make(map[string]int)
+
+	if config == nil {
+		return nil
+	}
+
+	for _, cmd := range config.Commands {
+		c := cmd.Words
+		ipv6 := cmd.HasPrefix("set", "ipv6", "static-route")
+
+		if ipv6 {
+			c = c[1:]
+		} else if !cmd.HasPrefix("set", "static-route") {
+			continue
+		}
+
+		discard := len(c) == 5 && c[3] == "nexthop" && (c[4] == "blackhole" || c[4] == "reject")
+
+		// set static-route <dest> nexthop gateway [address|logical] <gw> [priority <n>] on
+		if !discard && (len(c) < 6 || c[3] != "nexthop" || c[4] != "gateway" || c[len(c) - 1] != "on") {
+			continue
+		}
+
+		dest := c[2]
+
+		if dest == "default" && ipv6 {
+			dest = "::/0"
+		} else if dest == "default" {
+			dest = "0.0.0.0/0"
+		}
+
+		_, ipNet, err := net.ParseCIDR(dest)
+		if err != nil {
+			continue
+		}
+
+		if discard {
+			routes = append(routes, RouteInfo{Net: ipNet.String(), Origin: originStatic, Discard: c[4]})
+			continue
+		}
+
+		var nextHop RouteNextHop
+
+		for i := 5; i + 1 < len(c); i++ {
+			switch c[i] {
+			case "address":
+				nextHop.Gateway = c[i + 1]
+				i++
+			case "logical", "interface":
+				nextHop.Dev = c[i + 1]
+				i++
+			case "priority":
+				nextHop.Priority, _ = strconv.Atoi(c[i + 1])
+				i++
+			default:
+				if i == 5 {
+					nextHop.Gateway = c[i]					// ipv6 has no 'address'
+				}
+			}
+		}
+
+		if _, found := index[ipNet.String()]; !found {
+			index[ipNet.String()] = len(routes)
+			routes = append(routes, RouteInfo{Net: ipNet.String(), Origin: originStatic})
+		}
+
+		r := &routes[index[ipNet.String()]]
+		r.NextHops = append(r.NextHops, nextHop)
+	}
+
+	return routes
+}
+
+//
+// staticRoutes returns the static routes to migrate. The configuration is preferred as it also holds the
+// backup next hops, which are not in the routing table. For an address family in neither every route
+// through a gateway is taken, with an unknown origin and next hops of the same destination as equal cost
+//
+func staticRoutes(hostData HostData, config *ClishConfig) (routes []RouteInfo) {
+	if routes = config.StaticRoutes(); len(routes) > 0 {
+		return routes
+	}
+
+	covered := make(map[bool]bool)					// isIPv6 -> in the routing table
+
+	for _, r := range hostData.RouteInfo {
+		covered[isIPv6(r.Net)] = true
+
+		if r.Origin == originStatic {
+			routes = append(routes, r)
+		}
+	}
+
+	for _, r := range groupRoutes(hostData.Routes) {
+		if !covered[isIPv6(r.Net)] {
+			routes = append(routes, r)
+		}
+	}
+
+	return routes
+}
+
+//
+//
+func groupRoutes(sshRoutes sshtool.Routes) (routes []RouteInfo) {
+	index := make(map[string]int)
+
+	for _, r := range sshRoutes {
+		if _, found := index[r.Net]; !found {
+			index[r.Net] = len(routes)
+			routes = append(routes, RouteInfo{Net: r.Net})
+		}
+
+		info := &routes[index[r.Net]]
+		info.NextHops = append(info.NextHops, RouteNextHop{Gateway: r.Gateway, Dev: r.Dev, Priority: 1})
+	}
+
+	return routes
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captured on a Gaia R80.40 gateway
+const showRoute = `Codes: C - Connected, S - Static, R - RIP, B - BGP (D - Default),
+       O - OSPF IntraArea (IA - InterArea, E - External, N - NSSA)
+       A - Aggregate, K - Kernel Remnant, H - Hidden, P - Suppressed,
+       U - Unreachable, i - Inactive
+
+S         0.0.0.0/0           via 10.0.0.254, eth0, cost 0, age 1234
+C         10.0.0.0/24         is directly connected, eth0
+O IA      10.5.0.0/16         via 10.0.0.5, eth0, cost 20, age 50
+S         172.16.0.0/12       via 192.168.100.254, eth1.100, cost 0, age 100
+                              via 192.168.100.253, eth1.100, cost 0, age 100
+`
+
+const showIPv6Route = `Codes: C - Connected, S - Static, R - RIP, B - BGP,
+       O - OSPF IntraArea (IA - InterArea, E - External, N - NSSA)
+       A - Aggregate, K - Kernel Remnant, H - Hidden, P - Suppressed
+
+C         2001:db8::/64       is directly connected, eth0
+S         2001:db8:5::/48     via 2001:db8::fe, eth0, cost 0, age 10
+`
+
+//
+//
+func TestParseShowRoute(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		info			[]RouteInfo
+	}{
+		{
+			"ipv4", showRoute,
+			[]RouteInfo{
+				{Net: "0.0.0.0/0", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "10.0.0.254", Dev: "eth0"}}},
+				{Net: "10.0.0.0/24", Origin: originConnected, NextHops: []RouteNextHop{{Dev: "eth0"}}},
+				{Net: "10.5.0.0/16", Origin: originOSPF, Metric: 20, NextHops: []RouteNextHop{{Gateway: "10.0.0.5", Dev: "eth0"}}},
+				{Net: "172.16.0.0/12", Origin: originStatic, NextHops: []RouteNextHop{
+					{Gateway: "192.168.100.254", Dev: "eth1.100"},
+					{Gateway: "192.168.100.253", Dev: "eth1.100"},
+				}},
+			},
+		},
+		{
+			"ipv6", showIPv6Route,
+			[]RouteInfo{
+				{Net: "2001:db8::/64", Origin: originConnected, NextHops: []RouteNextHop{{Dev: "eth0"}}},
+				{Net: "2001:db8:5::/48", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "2001:db8::fe", Dev: "eth0"}}},
+			},
+		},
+		{
+			"empty", "", nil,
+		},
+	}
+
+	for _, test := range tests {
+		if info := parseShowRoute(test.text); !reflect.DeepEqual(info, test.info) {
+			t.Errorf("%s:\n got %+v\nwant %+v", test.name, info, test.info)
+		}
+	}
+}
+
+//
+// the static routes of the configuration keep every next hop with its priority; routes which are off
+// are not migrated as static routes
+//
+func TestClishConfigStaticRoutes(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		routes			[]RouteInfo
+	}{
+		{
+			"ipv4",
+			`set static-route default nexthop gateway address 10.0.0.254 on
+set static-route 10.1.0.0/16 nexthop gateway address 10.0.0.254 priority 1 on
+set static-route 10.1.0.0/16 nexthop gateway address 10.0.0.253 priority 2 on
+set static-route 10.2.0.0/16 nexthop gateway logical eth1 on
+set static-route 10.3.0.0/16 nexthop blackhole
+set static-route 10.4.0.0/16 nexthop gateway address 10.0.0.254 off`,
+			[]RouteInfo{
+				{Net: "0.0.0.0/0", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "10.0.0.254"}}},
+				{Net: "10.1.0.0/16", Origin: originStatic, NextHops: []RouteNextHop{
+					{Gateway: "10.0.0.254", Priority: 1},
+					{Gateway: "10.0.0.253", Priority: 2},
+				}},
+				{Net: "10.2.0.0/16", Origin: originStatic, NextHops: []RouteNextHop{{Dev: "eth1"}}},
+				{Net: "10.3.0.0/16", Origin: originStatic, Discard: "blackhole"},
+			},
+		},
+		{
+			"ipv6",
+			`set ipv6 static-route default nexthop gateway 2001:db8::fe on
+set ipv6 static-route 2001:db8:1::/48 nexthop gateway 2001:db8::fe priority 1 on
+set ipv6 static-route 2001:db8:2::/48 nexthop gateway fe80::1 interface eth0 on
+set ipv6 static-route 2001:db8:3::/48 nexthop reject`,
+			[]RouteInfo{
+				{Net: "::/0", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "2001:db8::fe"}}},
+				{Net: "2001:db8:1::/48", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "2001:db8::fe", Priority: 1}}},
+				{Net: "2001:db8:2::/48", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "fe80::1", Dev: "eth0"}}},
+				{Net: "2001:db8:3::/48", Origin: originStatic, Discard: "reject"},
+			},
+		},
+		{
+			"none", "set hostname fw1", nil,
+		},
+	}
+
+	for _, test := range tests {
+		if routes := ParseClishConfig(test.text).StaticRoutes(); !reflect.DeepEqual(routes, test.routes) {
+			t.Errorf("%s:\n got %+v\nwant %+v", test.name, routes, test.routes)
+		}
+	}
+
+	var config *ClishConfig
+
+	if routes := config.StaticRoutes(); routes != nil {
+		t.Errorf("no configuration: got %+v", routes)
+	}
+}
+
+//
+// every route the configuration has comes out as a command which LintClish accepts
+//
+func TestRouteCommands(t *testing.T) {
+	routes := []RouteInfo{
+		{Net: "0.0.0.0/0", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "10.0.0.254"}}},
+		{Net: "10.1.0.0/16", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "10.0.0.254", Priority: 1}, {Gateway: "10.0.0.253", Priority: 2}}},
+		{Net: "10.2.0.0/16", Origin: originStatic, NextHops: []RouteNextHop{{Dev: "eth1"}}},
+		{Net: "10.3.0.0/16", Origin: originStatic, Discard: "blackhole"},
+		{Net: "::/0", Origin: originStatic, NextHops: []RouteNextHop{{Gateway: "fe80::1", Dev: "eth0"}}},
+		{Net: "2001:db8:1::/48", Origin: originStatic, NextHops: []RouteNextHop{{Dev: "eth0"}}},
+		{Net: "2001:db8:3::/48", Origin: originStatic, Discard: "reject"},
+	}
+
+	want := []string{
+		"set static-route default nexthop gateway address 10.0.0.254 on",
+		"set static-route 10.1.0.0/16 nexthop gateway address 10.0.0.254 priority 1 on",
+		"set static-route 10.1.0.0/16 nexthop gateway address 10.0.0.253 priority 2 on",
+		"set static-route 10.2.0.0/16 nexthop gateway logical eth1 on",
+		"set static-route 10.3.0.0/16 nexthop blackhole",
+		"set ipv6 static-route default nexthop gateway fe80::1 on",
+		"set ipv6 static-route 2001:db8:1::/48 nexthop gateway logical eth0 on",
+		"set ipv6 static-route 2001:db8:3::/48 nexthop reject",
+	}
+
+	commands := routeCommands(routes)
+
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("\n got %q\nwant %q", commands, want)
+	}
+
+	script := "set interface eth0 ipv4-address 10.0.0.1 mask-length 24\nset interface eth1 state on\n" + strings.Join(commands, "\n")
+
+	for _, problem := range LintClish(script) {
+		t.Errorf("lint: %s", problem.String())
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// a snapshot is a directory holding one json document (see json.go) per host
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"github.com/mikejac/ssh.golang"
+)
+
+type SnapshotDiff struct {
+	Name					string
+	Added					bool
+	Removed				bool
+	Changes				[]string
+}
+
+//
+// NewSnapshotDir creates a new timestamped snapshot directory below 'dir'
+//
+func NewSnapshotDir(dir string) (snapDir string, err error) {
+	snapDir = filepath.Join(dir, time.Now().Format("20060102-150405"))
+
+	if err = os.MkdirAll(snapDir, 0700); err != nil {
+		return "", err
+	}
+
+	return snapDir, nil
+}
+
+//
+//
+func SaveSnapshotHost(snapDir string, host JsonHost) (err error) {
+	doc := NewJsonDocument("snapshot")
+	doc.Hosts = append(doc.Hosts, host)
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(snapDir, host.Name + ".json"), b, 0600)
+}
+
+//
+// LoadSnapshot reads all host files in a snapshot directory, keyed by host name
+//
+func LoadSnapshot(snapDir string) (hosts map[string]JsonHost, err error) {
+	files := []string{snapDir}
+
+	// a single json document, e.g. saved output of 'check --format=json', is a snapshot as well
+	if info, err := os.Stat(snapDir); err != nil || info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(snapDir, "*.json")); err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no host files found in %s", snapDir)
+	}
+
+	hosts = make(map[string]JsonHost)
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc JsonDocument
+
+		if err = json.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %s", f, err.Error())
+		}
+		if doc.SchemaVersion != JsonSchemaVersion {
+			return nil, fmt.Errorf("%s: unsupported schema version %d", f, doc.SchemaVersion)
+		}
+
+		for _, h := range doc.Hosts {
+			hosts[h.Name] = h
+		}
+
+		// the output of 'check --format=json' holds cluster members inside the clusters
+		for _, c := range doc.Clusters {
+			for _, h := range c.Members {
+				if _, ok := hosts[h.Name]; !ok {
+					hosts[h.Name] = h
+				}
+			}
+		}
+	}
+
+	return hosts, nil
+}
+
+//
+// DiffSnapshots compares every host in snapshot A with the same host in snapshot B
+//
+func DiffSnapshots(hostsA map[string]JsonHost, hostsB map[string]JsonHost, verbose int) (diffs []SnapshotDiff) {
+	var names []string
+
+	for name := range hostsA {
+		names = append(names, name)
+	}
+	for name := range hostsB {
+		if _, ok := hostsA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		a, inA := hostsA[name]
+		b, inB := hostsB[name]
+
+		if !inA {
+			diffs = append(diffs, SnapshotDiff{Name: name, Added: true})
+		} else if !inB {
+			diffs = append(diffs, SnapshotDiff{Name: name, Removed: true})
+		} else {
+			diffs = append(diffs, SnapshotDiff{Name: name, Changes: diffSnapshotHost(a, b, verbose)})
+		}
+	}
+
+	return diffs
+}
+
+//
+//
+func diffSnapshotHost(a JsonHost, b JsonHost, verbose int) (changes []string) {
+	if a.Ok != b.Ok {
+		changes = append(changes, fmt.Sprintf("ok: %t -> %t", a.Ok, b.Ok))
+	}
+	if a.Osclass != b.Osclass || a.Ostype != b.Ostype {
+		changes = append(changes, fmt.Sprintf("os: %s/%s -> %s/%s", a.Osclass, a.Ostype, b.Osclass, b.Ostype))
+	}
+	if a.FwVer != b.FwVer {
+		changes = append(changes, fmt.Sprintf("fwver: \"%s\" -> \"%s\"", a.FwVer, b.FwVer))
+	}
+	if a.Platform != b.Platform {
+		changes = append(changes, fmt.Sprintf("platform: \"%s\" -> \"%s\"", a.Platform, b.Platform))
+	}
+	if cphaStatus(a.Cpha) != cphaStatus(b.Cpha) {
+		changes = append(changes, fmt.Sprintf("cpha: \"%s\" -> \"%s\"", cphaStatus(a.Cpha), cphaStatus(b.Cpha)))
+	}
+
+	// logical interfaces, keyed by name
+	ifA := make(map[string]string)
+	ifB := make(map[string]string)
+
+	for _, i := range a.LogicalInterfaces {
+		ifA[logicalKey(i)] = i.IfIP
+	}
+	for _, i := range b.LogicalInterfaces {
+		ifB[logicalKey(i)] = i.IfIP
+	}
+
+	for _, name := range sortedKeys(ifA) {
+		if ip, ok := ifB[name]; !ok {
+			changes = append(changes, fmt.Sprintf("interface removed: %s %s", name, ifA[name]))
+		} else if ip != ifA[name] {
+			changes = append(changes, fmt.Sprintf("interface changed: %s %s -> %s", name, ifA[name], ip))
+		}
+	}
+	for _, name := range sortedKeys(ifB) {
+		if _, ok := ifA[name]; !ok {
+			changes = append(changes, fmt.Sprintf("interface added: %s %s", name, ifB[name]))
+		}
+	}
+
+	// physical interfaces and their VLANs
+	phyA := make(map[string]string)
+	phyB := make(map[string]string)
+
+	for _, i := range a.PhysicalInterfaces {
+		phyA[physicalKey(i.IfName, i.VLAN)] = i.IfName
+	}
+	for _, i := range b.PhysicalInterfaces {
+		phyB[physicalKey(i.IfName, i.VLAN)] = i.IfName
+	}
+
+	for _, key := range sortedKeys(phyA) {
+		if _, ok := phyB[key]; !ok {
+			changes = append(changes, fmt.Sprintf("%s removed: %s", physicalKind(key), key))
+		}
+	}
+	for _, key := range sortedKeys(phyB) {
+		if _, ok := phyA[key]; !ok {
+			changes = append(changes, fmt.Sprintf("%s added: %s", physicalKind(key), key))
+		}
+	}
+
+	// routes; the host is compared against its own past instead of a cluster peer
+	_, removedRoutes, addedRoutes := CompareNetworks(a.Routes, b.Routes, verbose)
+
+	for _, r := range removedRoutes {
+		changes = append(changes, fmt.Sprintf("route removed: %-20s -> %-16s dev %s", r.Net, r.Gateway, r.Dev))
+	}
+	for _, r := range addedRoutes {
+		changes = append(changes, fmt.Sprintf("route added: %-20s -> %-16s dev %s", r.Net, r.Gateway, r.Dev))
+	}
+
+	return changes
+}
+
+//
+//
+func cphaStatus(cpha *sshtool.CphaData) (status string) {
+	if cpha == nil {
+		return "null"
+	}
+
+	return cpha.Status
+}
+
+//
+//
+func physicalKey(ifName string, vlan string) (key string) {
+	if vlan == "" {
+		return ifName
+	}
+
+	return ifName + " vlan " + vlan
+}
+
+//
+//
+func physicalKind(key string) (kind string) {
+	if strings.Contains(key, " vlan ") {
+		return "vlan"
+	}
+
+	return "physical interface"
+}
+
+//
+//
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+//
+//
+func (print *PrintData) PrintSnapshotDiff(diffs []SnapshotDiff) {
+	changed := 0
+
+	for _, d := range diffs {
+		if d.Added {
+			fmt.Fprintf(print.writer, "host:%s:added\n", d.Name)
+			changed++
+		} else if d.Removed {
+			fmt.Fprintf(print.writer, "host:%s:removed\n", d.Name)
+			changed++
+		} else if len(d.Changes) > 0 {
+			fmt.Fprintf(print.writer, "host:%s:changed\n", d.Name)
+
+			for _, c := range d.Changes {
+				fmt.Fprintf(print.writer, "  %s\n", c)
+			}
+
+			changed++
+		} else if verbose >= 1 {
+			fmt.Fprintf(print.writer, "host:%s:unchanged\n", d.Name)
+		}
+	}
+
+	fmt.Fprintln(print.writer)
+	fmt.Fprintf(print.writer, "Hosts compared: %d, hosts with changes: %d\n", len(diffs), changed)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/mikejac/ssh.golang"
+)
+
+//
+// testRoutes builds routes from "net gateway dev" lines
+//
+func testRoutes(t *testing.T, lines ...string) (routes sshtool.Routes) {
+	for _, l := range lines {
+		f := strings.Fields(l)
+
+		_, ipNet, err := net.ParseCIDR(f[0])
+		if err != nil || len(f) != 3 {
+			t.Fatalf("invalid test route '%s'", l)
+		}
+
+		routes = append(routes, sshtool.NetworkRoute{Net: ipNet.String(), Gateway: f[1], Dev: f[2], IPNet: ipNet})
+	}
+
+	return routes
+}
+
+//
+//
+func TestDiffSnapshots(t *testing.T) {
+	fw1 := JsonHost{
+		Name:					"fw1",
+		Ok:						true,
+		FwVer:					"R80.40",
+		Cpha:					&sshtool.CphaData{Status: "active"},
+		LogicalInterfaces:		sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.1/24"}, {IfName: "eth1.100", IfIP: "192.168.100.1/24"}},
+		PhysicalInterfaces:	sshtool.PhysicalInterfaces{{IfName: "eth0"}, {IfName: "eth1"}, {IfName: "eth1", VLAN: "100"}},
+		Routes:					testRoutes(t, "0.0.0.0/0 10.0.0.254 eth0", "172.16.0.0/12 192.168.100.254 eth1.100"),
+	}
+
+	changed := fw1
+	changed.FwVer				= "R81.10"
+	changed.Cpha				= &sshtool.CphaData{Status: "standby"}
+	changed.LogicalInterfaces	= sshtool.LogicalInterfaces{{IfName: "eth0", IfIP: "10.0.0.2/24"}, {IfName: "eth2", IfIP: "172.31.0.1/24"}}
+	changed.PhysicalInterfaces	= sshtool.PhysicalInterfaces{{IfName: "eth0"}, {IfName: "eth1"}, {IfName: "eth2"}}
+	changed.Routes				= testRoutes(t, "0.0.0.0/0 10.0.0.253 eth0", "172.16.0.0/12 192.168.100.254 eth1.100")
+
+	tests := []struct {
+		name			string
+		a				map[string]JsonHost
+		b				map[string]JsonHost
+		diffs			[]SnapshotDiff
+	}{
+		{
+			"unchanged",
+			map[string]JsonHost{"fw1": fw1},
+			map[string]JsonHost{"fw1": fw1},
+			[]SnapshotDiff{{Name: "fw1"}},
+		},
+		{
+			"added and removed",
+			map[string]JsonHost{"fw1": fw1},
+			map[string]JsonHost{"fw2": fw1},
+			[]SnapshotDiff{{Name: "fw1", Removed: true}, {Name: "fw2", Added: true}},
+		},
+		{
+			"changed",
+			map[string]JsonHost{"fw1": fw1},
+			map[string]JsonHost{"fw1": changed},
+			[]SnapshotDiff{{Name: "fw1", Changes: []string{
+				`fwver: "R80.40" -> "R81.10"`,
+				`cpha: "active" -> "standby"`,
+				"interface changed: eth0 10.0.0.1/24 -> 10.0.0.2/24",
+				"interface removed: eth1.100 192.168.100.1/24",
+				"interface added: eth2 172.31.0.1/24",
+				"vlan removed: eth1 vlan 100",
+				"physical interface added: eth2",
+				"route removed: 0.0.0.0/0            -> 10.0.0.254       dev eth0",
+				"route added: 0.0.0.0/0            -> 10.0.0.253       dev eth0",
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		if diffs := DiffSnapshots(test.a, test.b, 0); !reflect.DeepEqual(diffs, test.diffs) {
+			t.Errorf("%s:\n got %+v\nwant %+v", test.name, diffs, test.diffs)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+//
+// the vault is a json file holding the entries encrypted with AES-256-GCM. The key is derived from the
+// master passphrase with scrypt
+//
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	vaultVersion			= 1
+	defaultVaultFile		= "~/.ckptool/vault"
+)
+
+type VaultEntry struct {
+	SSHPassword			string						`json:"ssh_password,omitempty"`
+	ExpertPassword		string						`json:"expert_password,omitempty"`
+}
+
+type VaultData struct {
+	file					string
+	salt					[]byte
+	key					[]byte
+	Entries				map[string]VaultEntry
+}
+
+type vaultFile struct {
+	Version				int							`json:"version"`
+	Salt					[]byte						`json:"salt"`
+	Nonce					[]byte						`json:"nonce"`
+	Data					[]byte						`json:"data"`
+}
+
+//
+// VaultFile returns the location of the vault; 'vault_file' in the [defaults] section of the hosts file
+//
+func VaultFile(hosts *HostsData) (file string) {
+	if val, ok := hosts.GetDefault("vault_file"); ok {
+		return val
+	}
+
+	return defaultVaultFile
+}
+
+//
+// LoadVault opens the vault if there is one; the passphrase comes from the credential sources
+//
+func LoadVault(hosts *HostsData, credentials *CredentialStore) (vault *VaultData, err error) {
+	file := VaultFile(hosts)
+
+	if _, err := os.Stat(expandHome(file)); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	passphrase, ok := credentials.Get(credVault, "Vault Passphrase: ")
+	if !ok {
+		return nil, fmt.Errorf("no passphrase for vault %s", file)
+	}
+
+	return OpenVault(file, passphrase)
+}
+
+//
+// CreateVault creates a new, empty vault. An existing vault is never overwritten
+//
+func CreateVault(file string, passphrase string) (vault *VaultData, err error) {
+	file = expandHome(file)
+
+	if _, err := os.Stat(file); err == nil {
+		return nil, fmt.Errorf("%s already exists", file)
+	}
+
+	vault = &VaultData{
+		file:		file,
+		salt:		make([]byte, 16),
+		Entries:	make(map[string]VaultEntry),
+	}
+
+	if _, err = io.ReadFull(rand.Reader, vault.salt); err != nil {
+		return nil, err
+	}
+	if vault.key, err = vaultKey(passphrase, vault.salt); err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+
+	return vault, vault.Save()
+}
+
+//
+//
+func OpenVault(file string, passphrase string) (vault *VaultData, err error) {
+	file = expandHome(file)
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var vf vaultFile
+
+	if err = json.Unmarshal(b, &vf); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	if vf.Version != vaultVersion {
+		return nil, fmt.Errorf("%s: unsupported vault version %d", file, vf.Version)
+	}
+
+	vault = &VaultData{
+		file:	file,
+		salt:	vf.Salt,
+	}
+
+	if vault.key, err = vaultKey(passphrase, vault.salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := vaultCipher(vault.key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := gcm.Open(nil, vf.Nonce, vf.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase or damaged vault", file)
+	}
+
+	if err = json.Unmarshal(plain, &vault.Entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	if vault.Entries == nil {
+		vault.Entries = make(map[string]VaultEntry)
+	}
+
+	return vault, nil
+}
+
+//
+//
+func (vault *VaultData) Save() (err error) {
+	plain, err := json.Marshal(vault.Entries)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := vaultCipher(vault.key)
+	if err != nil {
+		return err
+	}
+
+	vf := vaultFile{
+		Version:	vaultVersion,
+		Salt:		vault.salt,
+		Nonce:		make([]byte, gcm.NonceSize()),
+	}
+
+	if _, err = io.ReadFull(rand.Reader, vf.Nonce); err != nil {
+		return err
+	}
+
+	vf.Data = gcm.Seal(nil, vf.Nonce, plain, nil)
+
+	b, err := json.MarshalIndent(vf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a failed write doesn't destroy the vault
+	tmp := vault.file + ".tmp"
+
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, vault.file)
+}
+
+//
+// Lookup returns the password of the given kind from the first of 'keys' which has one; keys go from
+// the most to the least specific, e.g. host name, section
+//
+func (vault *VaultData) Lookup(kind string, keys ...string) (password string, key string, ok bool) {
+	if vault == nil {
+		return "", "", false
+	}
+
+	for _, k := range keys {
+		e, found := vault.Entries[k]
+		if !found {
+			continue
+		}
+
+		// jump hosts have their own entries, named after the jump host
+		if (kind == credSSH || kind == credJump) && e.SSHPassword != "" {
+			return e.SSHPassword, k, true
+		}
+		if kind == credExpert && e.ExpertPassword != "" {
+			return e.ExpertPassword, k, true
+		}
+	}
+
+	return "", "", false
+}
+
+//
+//
+func (vault *VaultData) Keys() (keys []string) {
+	for k := range vault.Entries {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+//
+//
+func vaultKey(passphrase string, salt []byte) (key []byte, err error) {
+	return scrypt.Key([]byte(passphrase), salt, 32768, 8, 1, 32)
+}
+
+//
+//
+func vaultCipher(key []byte) (gcm cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
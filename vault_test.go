@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//
+// a vault which was saved opens with the same entries, and only with its passphrase
+//
+func TestVaultRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ckptool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "vault")
+
+	vault, err := CreateVault(file, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault.Entries["fw1"] = VaultEntry{SSHPassword: "fw1-ssh"}
+	vault.Entries["lab"] = VaultEntry{SSHPassword: "lab-ssh", ExpertPassword: "lab-expert"}
+
+	if err = vault.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = CreateVault(file, "secret"); err == nil {
+		t.Errorf("CreateVault overwrote an existing vault")
+	}
+	if _, err = OpenVault(file, "wrong"); err == nil {
+		t.Errorf("OpenVault accepted a wrong passphrase")
+	}
+
+	opened, err := OpenVault(file, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(opened.Entries, vault.Entries) {
+		t.Errorf("entries\n got %v\nwant %v", opened.Entries, vault.Entries)
+	}
+	if keys := opened.Keys(); !reflect.DeepEqual(keys, []string{"fw1", "lab"}) {
+		t.Errorf("keys: got %v", keys)
+	}
+
+	tests := []struct {
+		kind			string
+		keys			[]string
+		password		string
+		key			string
+		ok				bool
+	}{
+		{credSSH,		[]string{"fw1", "lab"},	"fw1-ssh",		"fw1",	true},
+		{credExpert,	[]string{"fw1", "lab"},	"lab-expert",	"lab",	true},		// fw1 has no expert password
+		{credJump,		[]string{"lab"},			"lab-ssh",		"lab",	true},
+		{credSSH,		[]string{"fw2"},			"",				"",		false},
+	}
+
+	for _, test := range tests {
+		password, key, ok := opened.Lookup(test.kind, test.keys...)
+
+		if password != test.password || key != test.key || ok != test.ok {
+			t.Errorf("Lookup(%s, %v) = %q, %q, %t; want %q, %q, %t", test.kind, test.keys, password, key, ok, test.password, test.key, test.ok)
+		}
+	}
+}
+
+//
+// a host takes its passwords from its own entry, then from its cluster section and then from its
+// inventory sections
+//
+func TestHostPasswords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ckptool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "hosts.ini")
+
+	text := `[berlin]
+fwa = ip:10.0.0.1,user:admin
+fwb = 10.0.0.2
+fwc = 10.0.0.3
+
+[cluster.c1]
+fwa = user:fwadmin
+fwb = 10.1.0.2
+`
+	if err = ioutil.WriteFile(file, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := NewHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := &VaultData{Entries: map[string]VaultEntry{
+		"fwb":			VaultEntry{SSHPassword: "fwb-ssh"},
+		"cluster.c1":	VaultEntry{SSHPassword: "c1-ssh", ExpertPassword: "c1-expert"},
+		"berlin":		VaultEntry{SSHPassword: "berlin-ssh", ExpertPassword: "berlin-expert"},
+	}}
+
+	tests := []struct {
+		host			string
+		ip				string
+		user			string
+		password		string
+		expert			string
+	}{
+		{"fwa",	"10.0.0.1",	"fwadmin",	"c1-ssh",		"c1-expert"},
+		{"fwb",	"10.1.0.2",	"",			"fwb-ssh",		"c1-expert"},
+		{"fwc",	"10.0.0.3",	"",			"berlin-ssh",	"berlin-expert"},
+	}
+
+	for _, test := range tests {
+		conn, err := hosts.GetConnSettings(test.host, Login{Vault: vault})
+		if err != nil {
+			t.Errorf("%s: %s", test.host, err.Error())
+			continue
+		}
+
+		if conn.Host != test.ip || conn.User != test.user || conn.Password != test.password || conn.ExpertPassword != test.expert {
+			t.Errorf("%s: got %s, %q, %q, %q; want %s, %q, %q, %q", test.host, conn.Host, conn.User, conn.Password, conn.ExpertPassword,
+				test.ip, test.user, test.password, test.expert)
+		}
+	}
+}
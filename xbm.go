@@ -0,0 +1,319 @@
+/*
+ * Copyright (c) 2016 Michael Jacobsen (github.com/mikejac)
+ *
+ * This file is part of ckptool.golang.
+ *
+ * ckptool.golang is free software: you can redistribute
+ * it and/or modify it under the terms of the GNU General Public License
+ * as published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * ckptool.golang is distributed in the hope that it will
+ * be useful, but WITHOUT ANY WARRANTY; without even the implied warranty
+ * of MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with ckptool.golang.  If not,
+ * see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"github.com/mikejac/ssh.golang"
+)
+
+type VAPData struct {
+	Group					string
+	Index					int							// VAPs of a group are numbered from 1
+	HostData				HostData
+	Ok						bool
+}
+
+//
+//
+func (vap VAPData) Name() (name string) {
+	return fmt.Sprintf("%s/%d", vap.Group, vap.Index)
+}
+
+//
+//
+func sortedVAPGroups(vapGroups sshtool.VAPGroups) (groups []string) {
+	for g := range vapGroups {
+		groups = append(groups, g)
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
+//
+// PrintVAPs writes the report of every VAP of a CPM; what could not be collected is listed instead of
+// the configuration
+//
+func (print *PrintData) PrintVAPs(vaps []VAPData) {
+	for _, vap := range vaps {
+		fmt.Fprintf(print.writer, "=========================================================\n")
+		fmt.Fprintf(print.writer, "VAP group: %s, VAP: %d\n", vap.Group, vap.Index)
+
+		h := vap.HostData
+
+		if !vap.Ok {
+			if (h.Errors & errConnect) != 0 {
+				fmt.Fprintf(print.writer, " Error: could not connect to VAP: %s\n", h.ConnectText)
+			}
+			if (h.Errors & errLogicalInterfaces) != 0 {
+				fmt.Fprintf(print.writer, " Error: could not retrieve logical interface\n")
+			}
+			if (h.Errors & errPhysicalInterfaces) != 0 {
+				fmt.Fprintf(print.writer, " Error: could not retrieve physical interface\n")
+			}
+			if (h.Errors & errRoutes) != 0 {
+				fmt.Fprintf(print.writer, " Error: could not retrieve routes\n")
+			}
+			if (h.Errors & errCpha) != 0 {
+				fmt.Fprintf(print.writer, " Error: could not retrieve CPHA information\n")
+			}
+
+			fmt.Fprintln(print.writer)
+			continue
+		}
+
+		print.PrintCPHA(h.Cpha)
+		print.PrintInterfaces(h.PhysicalInterfaces, h.LogicalInterfaces)
+		print.PrintRoutes(groupRoutes(h.Routes))
+
+		fmt.Fprintln(print.writer)
+	}
+}
+
+//
+// checkXBM checks the VAP groups of an XBM chassis like clusters: the VAPs of a group must have the same
+// routes and interfaces and a working CPHA. Every VAP is entered through the CPM in turn, so a chassis is
+// collected one VAP at a time
+//
+func checkXBM(out io.Writer, hosts *HostsData, chassis string, login Login, verbose int) (clusterData []ClusterData, clusterOk []bool) {
+	cpm := hosts.GetXBMCPM(chassis)
+	groups := hosts.GetXBMVAPGroups(chassis)
+
+	conn, err := hosts.GetConnSettings(cpm, login)
+
+	fmt.Fprintf(out, "xbm:%s:addr:%s\n", chassis, conn.Host)
+
+	cpmData := HostData{Name: cpm}
+
+	var ssh Gateway
+
+	if err == nil {
+		ssh, err = newGateway(conn, verbose)
+	}
+
+	if err == nil {
+		if err := ssh.Connect(); err == nil {
+			var osclass		sshtool.OsClass
+			var vapGroups	sshtool.VAPGroups
+
+			if osclass, _, err = ssh.GetOS(); err == nil && osclass == sshtool.OsClassXBM {
+				if vapGroups, err = ssh.GetVAPGroups(); err == nil {
+					if len(groups) == 0 {
+						groups = sortedVAPGroups(vapGroups)
+					}
+
+					for _, group := range groups {
+						cd, ok := checkVAPGroup(out, hosts, ssh, chassis, group, vapGroups[group], verbose)
+
+						clusterData	= append(clusterData, cd)
+						clusterOk		= append(clusterOk, ok)
+					}
+				} else {
+					cpmData.Errors |= errOS
+					fmt.Fprintf(out, "ERROR: %s\n", err.Error())
+				}
+			} else if err == nil {
+				cpmData.Errors |= errOS
+				fmt.Fprintf(out, "ERROR: %s is not a CrossBeam CPM\n", cpm)
+			} else {
+				cpmData.Errors |= errOS
+				fmt.Fprintf(out, "ERROR: %s\n", err.Error())
+			}
+
+			ssh.Exit()
+			ssh.Disconnect()
+		} else {
+			cpmData.ConnectText = err.Error()
+			cpmData.Errors |= errConnect
+		}
+	} else {
+		cpmData.ConnectText = err.Error()
+		cpmData.Errors |= errConnect
+	}
+
+	if cpmData.Errors != 0 {
+		fmt.Fprintf(out, "xbm:%s:ok:false\n", chassis)
+
+		// the groups could not be checked; the CPM is reported as their only member
+		if len(groups) == 0 {
+			groups = []string{""}
+		}
+
+		for _, group := range groups {
+			cd := ClusterData{Name: xbmClusterName(chassis, group), Members: []string{cpm}, Hosts: map[string]HostData{cpm: cpmData}, Errors: errMembers}
+
+			fmt.Fprintf(out, "cluster:%s:ok:false\n", cd.Name)
+
+			clusterData	= append(clusterData, cd)
+			clusterOk		= append(clusterOk, false)
+		}
+	}
+
+	return clusterData, clusterOk
+}
+
+//
+// checkVAPGroup collects the 'count' VAPs of a group and compares them. The VAPs are named <group>/<index>,
+// which is also the member name ignore rules match
+//
+func checkVAPGroup(out io.Writer, hosts *HostsData, ssh Gateway, chassis string, group string, count int, verbose int) (clusterData ClusterData, ok bool) {
+	clusterData.Hosts		= make(map[string]HostData)
+	clusterData.Routes	= make(map[string]sshtool.Routes)
+	clusterData.Name		= xbmClusterName(chassis, group)
+
+	// like a cluster, a single VAP has nothing to be compared with
+	if count < 2 {
+		if count == 0 {
+			fmt.Fprintf(out, "ERROR: VAP group %s not found on %s\n", group, chassis)
+		} else {
+			fmt.Fprintf(out, "ERROR: VAP group %s on %s does not contain at least two VAPs\n", group, chassis)
+		}
+
+		fmt.Fprintf(out, "cluster:%s:ok:false\n", clusterData.Name)
+
+		clusterData.Errors |= errMembers
+
+		return clusterData, false
+	}
+
+	memberData := make([]HostData, count)
+	memberOk   := make([]bool, count)
+
+	for index := range memberData {
+		vap := VAPData{Group: group, Index: index + 1}
+
+		clusterData.Members = append(clusterData.Members, vap.Name())
+		memberData[index].Name = vap.Name()
+
+		if err := ssh.ConnectVAP(group, vap.Index); err == nil {
+			memberData[index], memberOk[index] = collectHost(ioutil.Discard, ssh, memberData[index])
+
+			ssh.DisconnectVAP()
+		} else {
+			memberData[index].ConnectText = err.Error()
+			memberData[index].Errors |= errConnect
+		}
+
+		fmt.Fprintf(out, "host:%s:ok:%t\n", vap.Name(), memberOk[index])
+
+		if memberOk[index] {
+			fmt.Fprintf(out, "host:%s:cpha:\"%s\"\n", vap.Name(), memberData[index].Cpha.Status)
+		} else {
+			fmt.Fprintf(out, "host:%s:cpha:null\n", vap.Name())
+		}
+	}
+
+	return compareCluster(out, clusterData, memberData, memberOk, hosts.GetXBMIgnoredRoutes(chassis), verbose)
+}
+
+//
+//
+func xbmClusterName(chassis string, group string) (name string) {
+	if group == "" {
+		return chassis
+	}
+
+	return chassis + "/" + group
+}
+
+//
+// doVAPGroup collects a VAP group for migrate. The VAPs of a group share one configuration, so the first
+// VAP which can be collected is used
+//
+func doVAPGroup(out io.Writer, conn ConnSettings, group string, verbose int) (hostData HostData, ok bool) {
+	hostData.Name = group
+
+	ssh, err := newGateway(conn, verbose)
+
+	if err == nil {
+		fmt.Fprintf(out, "Connecting ... ")
+
+		if err := ssh.Connect(); err == nil {
+			fmt.Fprintf(out, "done\n")
+			fmt.Fprintf(out, "Retriveing OS information ... ")
+
+			var osclass		sshtool.OsClass
+
+			if osclass, _, err = ssh.GetOS(); err == nil && osclass == sshtool.OsClassXBM {
+				fmt.Fprintf(out, "done\n")
+				fmt.Fprintf(out, "Retrieving VAP groups ... ")
+
+				if vapGroups, err := ssh.GetVAPGroups(); err == nil && vapGroups[group] > 0 {
+					fmt.Fprintf(out, "done\n")
+
+					for index := 1; index <= vapGroups[group] && !ok; index++ {
+						vap := VAPData{Group: group, Index: index}
+
+						fmt.Fprintf(out, "Connecting to VAP %s ... ", vap.Name())
+
+						if err = ssh.ConnectVAP(group, index); err == nil {
+							fmt.Fprintf(out, "done\n")
+
+							vapData := HostData{Name: group, Osclass: osclass}
+
+							if vapData, ok = collectHost(out, ssh, vapData); ok || index == vapGroups[group] {
+								hostData = vapData
+							}
+
+							ssh.DisconnectVAP()
+						} else {
+							hostData.Errors |= errConnect
+							fmt.Fprintln(out, "error: " + err.Error())
+						}
+					}
+
+					fmt.Fprintln(out)
+				} else if err == nil {
+					hostData.Errors |= errOS
+					fmt.Fprintf(out, "error: no VAP group %s\n", group)
+				} else {
+					hostData.Errors |= errOS
+					fmt.Fprintln(out, "error: " + err.Error())
+				}
+			} else if err == nil {
+				hostData.Errors |= errOS
+				fmt.Fprintln(out, "error: host is not an CrossBeam CPM")
+			} else {
+				hostData.Errors |= errOS
+				fmt.Fprintln(out, "error: " + err.Error())
+			}
+
+			ssh.Exit()
+			ssh.Disconnect()
+		} else {
+			hostData.ConnectText = err.Error()
+			hostData.Errors |= errConnect
+			fmt.Fprintln(out, "error: " + err.Error())
+		}
+	} else {
+		hostData.ConnectText = err.Error()
+		hostData.Errors |= errConnect
+		fmt.Fprintln(out, "error: " + err.Error())
+	}
+
+	return hostData, ok
+}